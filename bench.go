@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// benchScenario a Warehouse cleaned by every Planner of a benchmark
+// name the file it was read from, or the seed it was generated with
+type benchScenario struct {
+	name      string
+	warehouse Warehouse
+	cycles    uint
+}
+
+// benchResult the KPIs of a scenario cleaned by a Planner, and the time it took
+// givenUp the run took longer than the timeout of the benchmark
+type benchResult struct {
+	planner Planner
+	report  kpiReport
+	elapsed time.Duration
+	givenUp bool
+}
+
+// bench runs the bench subcommand, cleaning every scenario with every planner in parallel and comparing their KPIs
+func bench(arguments []string) error {
+	var planners, config string
+	var seeds, workers int
+	var seed int64
+	var timeout time.Duration
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.StringVar(&planners, "planners", "dfs,dijkstra", "planners compared, separated by commas")
+	flags.StringVar(&config, "generate", "", "JSON file of the parameters of the generated warehouses, named as the options of generate")
+	flags.IntVar(&seeds, "seeds", 1, "number of warehouses generated, with consecutive seeds")
+	flags.Int64Var(&seed, "seed", 1, "seed of the first warehouse generated")
+	flags.IntVar(&workers, "workers", runtime.NumCPU(), "number of runs in parallel")
+	flags.DurationVar(&timeout, "timeout", time.Minute, "time after which a run is given up, never when 0")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gotrans bench [options] [scenario...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); errors.Is(err, flag.ErrHelp) {
+		// The usage asked for is printed by the flags
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 && config == "" {
+		flags.Usage()
+		return errors.New("bench expects scenarios or a generator config")
+	}
+	if seeds < 1 || workers < 1 {
+		return errors.New("the seeds and the workers should be positive numbers")
+	}
+	if seeds != 1 && config == "" {
+		return errors.New("-seeds only applies to the warehouses generated with -generate")
+	}
+
+	compared, err := parsePlanners(planners)
+	if err != nil {
+		return err
+	}
+	scenarios, err := readBenchScenarios(flags.Args())
+	if err != nil {
+		return err
+	}
+	if config != "" {
+		params, err := loadGeneratorConfig(config)
+		if err != nil {
+			return err
+		}
+		for index := 0; index < seeds; index++ {
+			params.Seed = seed + int64(index)
+			warehouse, err := generateWarehouse(params)
+			if err != nil {
+				return fmt.Errorf("seed %d: %w", params.Seed, err)
+			}
+			scenarios = append(scenarios, benchScenario{
+				name:      fmt.Sprintf("seed %d", params.Seed),
+				warehouse: warehouse,
+				cycles:    params.Cycles,
+			})
+		}
+	}
+
+	results := runBench(scenarios, compared, workers, timeout)
+	fmt.Print(benchTable(compared, results))
+	return nil
+}
+
+// parsePlanners parses the names of the planners compared, separated by commas
+func parsePlanners(list string) ([]Planner, error) {
+	var planners []Planner
+
+	for _, name := range strings.Split(list, ",") {
+		planner, exists := nameToPlanner[strings.ToLower(strings.TrimSpace(name))]
+		if !exists {
+			return nil, fmt.Errorf("unknown planner %q, expected dfs or dijkstra", name)
+		}
+		planners = append(planners, planner)
+	}
+	return planners, nil
+}
+
+func readBenchScenarios(paths []string) ([]benchScenario, error) {
+	scenarios := make([]benchScenario, 0, len(paths))
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		warehouse, cycles, err := parseScenarioFile(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		scenarios = append(scenarios, benchScenario{name: path, warehouse: warehouse, cycles: cycles})
+	}
+	return scenarios, nil
+}
+
+// loadGeneratorConfig reads the parameters of the generated warehouses, the ones missing being the defaults of
+// generate
+func loadGeneratorConfig(path string) (generatorParameters, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return generatorParameters{}, err
+	}
+	params := defaultGeneratorParameters()
+	defaultWeights := params.Weights
+	params.Weights = nil
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&params); err != nil {
+		return generatorParameters{}, fmt.Errorf("invalid generator config: %w", err)
+	}
+	if params.Weights == nil {
+		params.Weights = defaultWeights
+	}
+	for color, odds := range params.Weights {
+		if _, ok := colorToWeight[color]; !ok || odds < 0 {
+			return generatorParameters{}, fmt.Errorf("invalid generator config: invalid weight %s=%d", color, odds)
+		}
+	}
+	return params, nil
+}
+
+// runBench cleans every scenario with every Planner, as many runs at once as there are workers
+func runBench(scenarios []benchScenario, planners []Planner, workers int, timeout time.Duration) []benchResult {
+	results := make([]benchResult, len(scenarios)*len(planners))
+	runs := make(chan int)
+	var group sync.WaitGroup
+
+	for worker := 0; worker < workers; worker++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for run := range runs {
+				scenario, planner := scenarios[run/len(planners)], planners[run%len(planners)]
+				results[run] = runBenchScenario(scenario, planner, timeout)
+			}
+		}()
+	}
+	for run := range results {
+		runs <- run
+	}
+	close(runs)
+	group.Wait()
+	return results
+}
+
+// runBenchScenario cleans a scenario with a Planner, giving it up after the timeout, the run stopping once the
+// cycle it's running is over
+func runBenchScenario(scenario benchScenario, planner Planner, timeout time.Duration) benchResult {
+	done := make(chan benchResult, 1)
+	stop := make(chan struct{})
+
+	go func() {
+		start := time.Now()
+		simulation := NewSimulation(scenario.warehouse.Clone(), scenario.cycles, planner)
+		statistics := newRunStatistics()
+		for !simulation.IsOver() {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			state := simulation.Step()
+			statistics.add(simulation.Cycle, state)
+		}
+		done <- benchResult{planner: planner, report: statistics.report(), elapsed: time.Since(start)}
+	}()
+
+	if timeout == 0 {
+		return <-done
+	}
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(timeout):
+		close(stop)
+		_, _ = fmt.Fprintf(os.Stderr, "%s with %s given up after %v\n", scenario.name, nameOf(nameToPlanner, planner),
+			timeout)
+		return benchResult{planner: planner, givenUp: true}
+	}
+}
+
+// benchTable compares the KPIs of the Planner, a column for every Planner giving the mean of every KPI over the
+// runs that weren't given up, followed by its variance when there are several of them
+func benchTable(planners []Planner, results []benchResult) string {
+	// The makespan is only known for the runs that delivered every package
+	kpis := []struct {
+		name  string
+		value func(benchResult) float64
+		known func(benchResult) bool
+	}{
+		{"makespan", func(result benchResult) float64 { return float64(result.report.Makespan) }, finished},
+		{"deliveries", func(result benchResult) float64 { return float64(result.report.Deliveries) }, nil},
+		{"deliveries per cycle", func(result benchResult) float64 { return result.report.DeliveriesPerCycle }, nil},
+		{"average latency", func(result benchResult) float64 { return result.report.AverageLatency }, nil},
+		{"truck trips", func(result benchResult) float64 { return float64(result.report.TruckTrips) }, nil},
+		{"full truck waits", func(result benchResult) float64 { return float64(result.report.FullTruckWaits) }, nil},
+		{"utilisation", func(result benchResult) float64 { return averageUtilisation(result.report) }, nil},
+		{"time (ms)", func(result benchResult) float64 { return float64(result.elapsed.Microseconds()) / 1000 }, nil},
+	}
+
+	var output strings.Builder
+	table := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprint(table, "kpi")
+	for _, planner := range planners {
+		_, _ = fmt.Fprintf(table, "\t%s", nameOf(nameToPlanner, planner))
+	}
+	_, _ = fmt.Fprint(table, "\nruns")
+	for _, planner := range planners {
+		finished, givenUp := 0, 0
+		for _, result := range results {
+			if result.planner == planner && result.givenUp {
+				givenUp++
+			} else if result.planner == planner {
+				finished++
+			}
+		}
+		_, _ = fmt.Fprintf(table, "\t%d, %d given up", finished, givenUp)
+	}
+	_, _ = fmt.Fprintln(table)
+
+	for _, kpi := range kpis {
+		_, _ = fmt.Fprint(table, kpi.name)
+		for _, planner := range planners {
+			var samples []float64
+			for _, result := range results {
+				if result.planner == planner && !result.givenUp && (kpi.known == nil || kpi.known(result)) {
+					samples = append(samples, kpi.value(result))
+				}
+			}
+			mean, variance := meanVariance(samples)
+			if len(samples) < 2 {
+				_, _ = fmt.Fprintf(table, "\t%.3f (n/a)", mean)
+				continue
+			}
+			_, _ = fmt.Fprintf(table, "\t%.3f (%.3f)", mean, variance)
+		}
+		_, _ = fmt.Fprintln(table)
+	}
+	_ = table.Flush()
+	return output.String()
+}
+
+func finished(result benchResult) bool {
+	return result.report.Finished
+}
+
+// averageUtilisation the utilisation of the ForkLift of a run, on average
+func averageUtilisation(report kpiReport) float64 {
+	if len(report.ForkLifts) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, forklift := range report.ForkLifts {
+		total += forklift.Utilisation
+	}
+	return total / float64(len(report.ForkLifts))
+}
+
+// meanVariance the mean of the samples and their variance, both 0 without any sample
+func meanVariance(samples []float64) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, sample := range samples {
+		mean += sample
+	}
+	mean /= float64(len(samples))
+
+	variance := 0.0
+	for _, sample := range samples {
+		variance += (sample - mean) * (sample - mean)
+	}
+	return mean, variance / float64(len(samples))
+}
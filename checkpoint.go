@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// jsonCheckpoint a Simulation saved between two cycles, to be resumed later on
+// Cycle the number of cycles already run
+// Scenario the Warehouse as it is after these cycles, its cycles being the ones the whole Simulation can last
+// Planner the algorithm finding the paths, the depth first one when omitted
+// Plans the paths the ForkLift were following
+type jsonCheckpoint struct {
+	Cycle    uint         `json:"cycle"`
+	Scenario jsonScenario `json:"scenario"`
+	Planner  string       `json:"planner,omitempty"`
+	Plans    []jsonPlan   `json:"plans,omitempty"`
+}
+
+type jsonPlan struct {
+	Current     jsonPosition   `json:"current"`
+	Destination jsonPosition   `json:"destination"`
+	Steps       []jsonPosition `json:"steps"`
+	Retrieval   int            `json:"retrieval,omitempty"`
+}
+
+// saveCheckpoint writes a running Simulation to a file, loadCheckpoint resuming it where it stopped
+func saveCheckpoint(path string, simulation *Simulation) error {
+	scenario, err := newJSONScenario(simulation.Warehouse, simulation.Cycles)
+	if err != nil {
+		return err
+	}
+	checkpoint := jsonCheckpoint{Cycle: simulation.Cycle, Scenario: scenario}
+	if simulation.Planner != DepthFirst {
+		checkpoint.Planner = nameOf(nameToPlanner, simulation.Planner)
+	}
+	for _, plan := range simulation.Plans() {
+		jsonPlan := jsonPlan{
+			Current:     newJSONPosition(plan.Current),
+			Destination: newJSONPosition(plan.Destination),
+			Steps:       make([]jsonPosition, 0, len(plan.Steps)),
+			Retrieval:   plan.Retrieval,
+		}
+		for _, step := range plan.Steps {
+			jsonPlan.Steps = append(jsonPlan.Steps, newJSONPosition(step))
+		}
+		checkpoint.Plans = append(checkpoint.Plans, jsonPlan)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(checkpoint)
+}
+
+// loadCheckpoint reads a Simulation saved by saveCheckpoint
+func loadCheckpoint(path string) (*Simulation, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint jsonCheckpoint
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+
+	warehouse, cycles, err := checkpoint.Scenario.warehouse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	if checkpoint.Cycle > cycles {
+		return nil, fmt.Errorf("invalid checkpoint: cycle %d is past the %d cycles of the scenario", checkpoint.Cycle, cycles)
+	}
+
+	planner := DepthFirst
+	if checkpoint.Planner != "" {
+		var exists bool
+		if planner, exists = nameToPlanner[strings.ToLower(checkpoint.Planner)]; !exists {
+			return nil, fmt.Errorf("invalid checkpoint: unknown planner %q", checkpoint.Planner)
+		}
+	}
+
+	plans := make([]Plan, 0, len(checkpoint.Plans))
+	for _, jsonPlan := range checkpoint.Plans {
+		plan := Plan{
+			Current:     jsonPlan.Current.position(),
+			Destination: jsonPlan.Destination.position(),
+			Retrieval:   jsonPlan.Retrieval,
+		}
+		for _, step := range jsonPlan.Steps {
+			plan.Steps = append(plan.Steps, step.position())
+		}
+		plans = append(plans, plan)
+	}
+	simulation, err := ResumeSimulation(warehouse, checkpoint.Cycle, cycles, planner, plans)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	return simulation, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// jsonEvent an Event of a cycle, written as a line of the event log
+// Type the kind of the Event, in snake case
+// Emitter the name of the ForkLift or the Truck the Event comes from
+// Target the Position a ForkLift moves to
+// Source the Position a Package is taken from
+// Reason why a ForkLift waits
+// Weight and MaxWeight the weight loaded in a Truck and the weight it can carry
+type jsonEvent struct {
+	Cycle         uint          `json:"cycle"`
+	Type          string        `json:"type"`
+	Emitter       string        `json:"emitter"`
+	Position      jsonPosition  `json:"position"`
+	Target        *jsonPosition `json:"target,omitempty"`
+	Source        *jsonPosition `json:"source,omitempty"`
+	Reason        string        `json:"reason,omitempty"`
+	Package       string        `json:"package,omitempty"`
+	PackageWeight int           `json:"package_weight,omitempty"`
+	Truck         string        `json:"truck,omitempty"`
+	Rack          string        `json:"rack,omitempty"`
+	Order         string        `json:"order,omitempty"`
+	Weight        *int          `json:"weight,omitempty"`
+	MaxWeight     int           `json:"max_weight,omitempty"`
+}
+
+var nameToWaitReason = map[string]WaitReason{
+	"idle":        Idle,
+	"blocked":     Blocked,
+	"crossing":    Crossing,
+	"retrieving":  Retrieving,
+	"full_truck":  FullTruck,
+	"full_rack":   FullRack,
+	"target_gone": TargetGone,
+}
+
+// eventLog streams the Event of every cycle as JSON Lines, one object per Event
+type eventLog struct {
+	encoder *json.Encoder
+}
+
+func newEventLog(file io.Writer) *eventLog {
+	return &eventLog{encoder: json.NewEncoder(file)}
+}
+
+// write writes the Event of a cycle, in the order they occurred
+func (log *eventLog) write(cycle uint, state CycleState) error {
+	for _, event := range state.Events {
+		jsonEvent, err := newJSONEvent(cycle, event)
+		if err != nil {
+			return err
+		}
+		if err = log.encoder.Encode(jsonEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newJSONEvent(cycle uint, event Event) (jsonEvent, error) {
+	jsonEvent := jsonEvent{Cycle: cycle, Emitter: event.EmitterName(), Position: newJSONPosition(event.AtPosition())}
+
+	switch event := event.(type) {
+	case PickupPackage:
+		jsonEvent.Type = "pickup_package"
+		jsonEvent.Package, jsonEvent.PackageWeight = event.PackageName(), int(event.PackageWeight())
+		source := newJSONPosition(event.FromPosition())
+		jsonEvent.Source = &source
+	case ForkliftWait:
+		jsonEvent.Type = "forklift_wait"
+		jsonEvent.Reason = nameOf(nameToWaitReason, event.Reason())
+	case ForkliftMove:
+		jsonEvent.Type = "forklift_move"
+		target := newJSONPosition(event.ToPosition())
+		jsonEvent.Target = &target
+	case DeliverPackage:
+		jsonEvent.Type = "deliver_package"
+		jsonEvent.Package, jsonEvent.PackageWeight = event.PackageName(), int(event.PackageWeight())
+		jsonEvent.Truck = event.TruckName()
+	case UnloadPackage:
+		jsonEvent.Type = "unload_package"
+		jsonEvent.Package, jsonEvent.PackageWeight = event.PackageName(), int(event.PackageWeight())
+		jsonEvent.Truck = event.TruckName()
+	case StorePackage:
+		jsonEvent.Type = "store_package"
+		jsonEvent.Package, jsonEvent.PackageWeight = event.PackageName(), int(event.PackageWeight())
+		jsonEvent.Rack = event.RackName()
+	case StagePackage:
+		jsonEvent.Type = "stage_package"
+		jsonEvent.Package, jsonEvent.PackageWeight = event.PackageName(), int(event.PackageWeight())
+		jsonEvent.Order = event.OrderName()
+	case OrderComplete:
+		jsonEvent.Type = "order_complete"
+		jsonEvent.Order, jsonEvent.Truck = event.OrderName(), event.EmitterName()
+	case TruckWait:
+		jsonEvent.Type = "truck_wait"
+		weight := int(event.ChargedWeight())
+		jsonEvent.Weight, jsonEvent.MaxWeight = &weight, int(event.MaxWeight())
+	case TruckGone:
+		jsonEvent.Type = "truck_gone"
+		weight := int(event.ChargedWeight())
+		jsonEvent.Weight, jsonEvent.MaxWeight = &weight, int(event.MaxWeight())
+	default:
+		return jsonEvent, fmt.Errorf("invalid type of warehouse event %T", event)
+	}
+	return jsonEvent, nil
+}
+
+// event reads back an Event written to the event log
+func (event jsonEvent) event() (Event, error) {
+	pos := event.Position.position()
+	pack := Package{Name: event.Package, Weight: Weight(event.PackageWeight)}
+	weight := Weight(0)
+	if event.Weight != nil {
+		weight = Weight(*event.Weight)
+	}
+
+	switch event.Type {
+	case "pickup_package":
+		if event.Source == nil {
+			return nil, errors.New("pickup_package event without its source")
+		}
+		return NewPickupPackage(event.Emitter, pos, pack, event.Source.position()), nil
+	case "forklift_wait":
+		reason, exists := nameToWaitReason[event.Reason]
+		if !exists {
+			return nil, fmt.Errorf("unknown wait reason %q", event.Reason)
+		}
+		return NewForkliftWait(event.Emitter, pos, reason), nil
+	case "forklift_move":
+		if event.Target == nil {
+			return nil, errors.New("forklift_move event without its target")
+		}
+		return NewForkliftMove(event.Emitter, pos, event.Target.position()), nil
+	case "deliver_package":
+		return NewDeliverPackage(event.Emitter, pos, pack, event.Truck), nil
+	case "unload_package":
+		return NewUnloadPackage(event.Emitter, pos, pack, event.Truck), nil
+	case "store_package":
+		return NewStorePackage(event.Emitter, pos, pack, event.Rack), nil
+	case "stage_package":
+		return NewStagePackage(event.Emitter, pos, pack, event.Order), nil
+	case "order_complete":
+		return NewOrderComplete(event.Emitter, pos, event.Order), nil
+	case "truck_wait":
+		return NewTruckWait(event.Emitter, pos, weight, Weight(event.MaxWeight)), nil
+	case "truck_gone":
+		return NewTruckGone(event.Emitter, pos, weight, Weight(event.MaxWeight)), nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", event.Type)
+	}
+}
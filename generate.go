@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// generatorParameters what the generated Warehouse is made of, named as the options of generate in a JSON config
+// Weights the relative odds of every package color
+// Obstacles the share of the tiles turned into walls
+type generatorParameters struct {
+	Length    int            `json:"length"`
+	Height    int            `json:"height"`
+	Cycles    uint           `json:"cycles"`
+	Packages  int            `json:"packages"`
+	Weights   map[string]int `json:"weights"`
+	ForkLifts int            `json:"forklifts"`
+	Trucks    int            `json:"trucks"`
+	Obstacles float64        `json:"obstacles"`
+	Seed      int64          `json:"-"`
+}
+
+// defaultGeneratorParameters the parameters of a generation without any option
+func defaultGeneratorParameters() generatorParameters {
+	return generatorParameters{
+		Length:    10,
+		Height:    8,
+		Cycles:    1000,
+		Packages:  5,
+		Weights:   map[string]int{"yellow": 1, "green": 1, "blue": 1},
+		ForkLifts: 2,
+		Trucks:    1,
+		Obstacles: 0.1,
+	}
+}
+
+// generate runs the generate subcommand, writing a random Warehouse to the output or the standard output
+func generate(arguments []string) error {
+	params := defaultGeneratorParameters()
+	var weights, output string
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	flags.IntVar(&params.Length, "length", params.Length, "warehouse length")
+	flags.IntVar(&params.Height, "height", params.Height, "warehouse height")
+	flags.UintVar(&params.Cycles, "cycles", params.Cycles, "number of execution cycles")
+	flags.IntVar(&params.Packages, "packages", params.Packages, "number of packages")
+	flags.StringVar(&weights, "weights", "yellow=1,green=1,blue=1", "relative odds of every package color")
+	flags.IntVar(&params.ForkLifts, "forklifts", params.ForkLifts, "number of forklifts")
+	flags.IntVar(&params.Trucks, "trucks", params.Trucks, "number of trucks")
+	flags.Float64Var(&params.Obstacles, "obstacles", params.Obstacles, "share of the tiles turned into walls, from 0 to 1")
+	flags.Int64Var(&params.Seed, "seed", 0, "seed of the generator, random when 0")
+	flags.StringVar(&output, "o", "", "output file, in JSON if it ends with .json, the standard output otherwise")
+	if err := flags.Parse(arguments); errors.Is(err, flag.ErrHelp) {
+		// The usage asked for is printed by the flags
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var err error
+	if params.Weights, err = parseWeights(weights); err != nil {
+		return err
+	}
+	if params.Seed == 0 {
+		params.Seed = time.Now().UnixNano()
+		_, _ = fmt.Fprintf(os.Stderr, "seed %d\n", params.Seed)
+	}
+
+	warehouse, err := generateWarehouse(params)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return writeInputFile(os.Stdout, warehouse, params.Cycles)
+	}
+	return writeScenarioFile(output, warehouse, params.Cycles)
+}
+
+// parseWeights parses the odds of the package colors, formatted as color=odds separated by commas
+func parseWeights(list string) (map[string]int, error) {
+	weights := make(map[string]int)
+
+	for _, weight := range strings.Split(list, ",") {
+		color, odds, found := strings.Cut(weight, "=")
+		number, err := strconv.Atoi(odds)
+		if _, ok := colorToWeight[strings.ToLower(color)]; !found || !ok || err != nil || number < 0 {
+			return nil, fmt.Errorf("invalid weights %q, expected <yellow|green|blue>=<odds>[,...]", list)
+		}
+		weights[strings.ToLower(color)] = number
+	}
+	return weights, nil
+}
+
+// generateWarehouse creates a random Warehouse every Package and Truck of which can be reached by every ForkLift:
+// walls, trucks and packages are only placed where the empty tiles stay connected
+func generateWarehouse(params generatorParameters) (Warehouse, error) {
+	if params.Length < 1 || params.Height < 1 {
+		return Warehouse{}, errors.New("warehouse length and height should be positive numbers")
+	}
+	if params.Packages < 0 || params.ForkLifts < 0 || params.Trucks < 0 {
+		return Warehouse{}, errors.New("entity counts can't be negative")
+	}
+	if params.Obstacles < 0 || params.Obstacles >= 1 {
+		return Warehouse{}, errors.New("obstacle density should be between 0 and 1")
+	}
+	if err := checkCycles(params.Cycles); err != nil {
+		return Warehouse{}, err
+	}
+	tiles := params.Length * params.Height
+	entities := params.Packages + params.ForkLifts + params.Trucks
+	if entities > tiles {
+		return Warehouse{}, errors.New("too many entities for the warehouse")
+	}
+
+	rng := rand.New(rand.NewSource(params.Seed))
+	warehouse := newWarehouse(params.Length, params.Height)
+	layout := newGeneratorLayout(warehouse, rng)
+
+	walls := int(params.Obstacles * float64(tiles))
+	if walls > tiles-entities {
+		walls = tiles - entities
+	}
+	for _, pos := range layout.block(walls, params.ForkLifts+params.Packages+params.Trucks, false) {
+		warehouse.Walls[pos] = true
+	}
+
+	trucks := layout.block(params.Trucks, params.ForkLifts+params.Packages, true)
+	packages := layout.block(params.Packages, params.ForkLifts, true)
+	if len(trucks) < params.Trucks || len(packages) < params.Packages {
+		return Warehouse{}, errors.New("not enough room to reach every entity, lower the obstacle density")
+	}
+	for index, pos := range trucks {
+		warehouse.Trucks[pos] = Truck{
+			Name:                  fmt.Sprintf("t%d", index+1),
+			MaxWeight:             Weight(500 + 100*rng.Intn(36)),
+			ElapseDischargingTime: 1 + rng.Intn(10),
+		}
+	}
+	for index, pos := range packages {
+		warehouse.Packages[pos] = Package{Name: fmt.Sprintf("p%d", index+1), Weight: randomWeight(rng, params.Weights)}
+	}
+	for index, pos := range layout.free(params.ForkLifts) {
+		warehouse.ForkLifts[pos] = ForkLift{Name: fmt.Sprintf("f%d", index+1)}
+	}
+	return warehouse, nil
+}
+
+// randomWeight draws the Weight of a Package following the odds of every color
+func randomWeight(rng *rand.Rand, weights map[string]int) Weight {
+	colors := []string{"yellow", "green", "blue"}
+	total := 0
+	for _, color := range colors {
+		total += weights[color]
+	}
+	if total == 0 {
+		return colorToWeight[colors[rng.Intn(len(colors))]]
+	}
+
+	draw := rng.Intn(total)
+	for _, color := range colors {
+		if draw < weights[color] {
+			return colorToWeight[color]
+		}
+		draw -= weights[color]
+	}
+	return colorToWeight[colors[len(colors)-1]]
+}
+
+// generatorLayout the tiles of a generated Warehouse still empty
+// order the tiles in the random order they're taken in
+// reachable the taken tiles that must stay next to an empty one
+type generatorLayout struct {
+	empty     map[Position]bool
+	order     []Position
+	reachable map[Position]bool
+}
+
+func newGeneratorLayout(warehouse Warehouse, rng *rand.Rand) *generatorLayout {
+	layout := &generatorLayout{empty: make(map[Position]bool), reachable: make(map[Position]bool)}
+
+	for y := 0; y < warehouse.Height; y++ {
+		for x := 0; x < warehouse.Length; x++ {
+			pos := Position{X: x, Y: y}
+			layout.empty[pos] = true
+			layout.order = append(layout.order, pos)
+		}
+	}
+	rng.Shuffle(len(layout.order), func(i, j int) {
+		layout.order[i], layout.order[j] = layout.order[j], layout.order[i]
+	})
+	return layout
+}
+
+// block takes up to count empty tiles, leaving at least kept of them, the remaining empty tiles staying connected,
+// every taken tile being next to one of them when reachable is set
+func (layout *generatorLayout) block(count int, kept int, reachable bool) []Position {
+	var blocked []Position
+
+	for _, pos := range layout.order {
+		if len(blocked) == count || len(layout.empty)-1 < kept {
+			break
+		}
+		if !layout.empty[pos] {
+			continue
+		}
+		layout.empty[pos] = false
+		if layout.isConnected() && layout.keepsReachable(pos) && (!reachable || layout.hasEmptyNeighbour(pos)) {
+			blocked = append(blocked, pos)
+			delete(layout.empty, pos)
+			layout.reachable[pos] = reachable
+		} else {
+			layout.empty[pos] = true
+		}
+	}
+	return blocked
+}
+
+// free takes count empty tiles, the tiles staying empty for the ForkLift to move on
+func (layout *generatorLayout) free(count int) []Position {
+	var taken []Position
+
+	for _, pos := range layout.order {
+		if len(taken) == count {
+			break
+		}
+		if layout.empty[pos] {
+			taken = append(taken, pos)
+		}
+	}
+	return taken
+}
+
+func (layout *generatorLayout) neighbours(pos Position) []Position {
+	return []Position{
+		{X: pos.X, Y: pos.Y - 1}, {X: pos.X + 1, Y: pos.Y}, {X: pos.X, Y: pos.Y + 1}, {X: pos.X - 1, Y: pos.Y},
+	}
+}
+
+// keepsReachable checks that taking a tile leaves the taken tiles next to it reachable
+func (layout *generatorLayout) keepsReachable(pos Position) bool {
+	for _, neighbour := range layout.neighbours(pos) {
+		if layout.reachable[neighbour] && !layout.hasEmptyNeighbour(neighbour) {
+			return false
+		}
+	}
+	return true
+}
+
+func (layout *generatorLayout) hasEmptyNeighbour(pos Position) bool {
+	for _, neighbour := range layout.neighbours(pos) {
+		if layout.empty[neighbour] {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnected checks that every empty tile can be reached from any other one
+func (layout *generatorLayout) isConnected() bool {
+	var start Position
+	count := 0
+	for pos, empty := range layout.empty {
+		if empty {
+			count++
+			start = pos
+		}
+	}
+	if count == 0 {
+		return true
+	}
+
+	seen := map[Position]bool{start: true}
+	queue := []Position{start}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, neighbour := range layout.neighbours(pos) {
+			if layout.empty[neighbour] && !seen[neighbour] {
+				seen[neighbour] = true
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+	return len(seen) == count
+}
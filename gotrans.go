@@ -2,9 +2,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 
 	"github.com/Harmos274/gotrans/warehouse"
 )
@@ -16,11 +21,39 @@ const helpText = "Gotrans\n" +
 	"Commands:\n" +
 	"-h --help\tShow help\n" +
 	"-g --graphic\tActivate the graphic mode\n" +
-	"<file>\t\tlaunch the program\n"
+	"-i --interactive\tShow the simulation in a full-screen terminal UI, with play/pause, stepping\n" +
+	"\t\tforward and back, speed control and a panel of the forklifts and trucks\n" +
+	"-c --convert <output>\tWrite the scenario to output, in JSON if it ends with .json, and exit\n" +
+	"-e --events <output>\tWrite the events as JSON Lines while the simulation runs,\n" +
+	"\t\tto the standard output in place of the prose when output is -\n" +
+	"-m --metrics <output>\tWrite the metrics of every cycle as CSV while the simulation runs,\n" +
+	"\t\tto the standard output in place of the prose when output is -\n" +
+	"-v --validate\tCheck the events against every rule of the warehouse while the simulation runs\n" +
+	"-k --kpis <text|json>\tPrint the KPIs of the run at its end, as text or JSON\n" +
+	"-H --heatmap <output>\tDraw the visits and the waits of every tile at the end of the run as a PNG,\n" +
+	"\t\tor print them on the terminal when output is -\n" +
+	"-p --planner <dfs|dijkstra>\tFind the paths depth first, the default, or with Dijkstra's algorithm\n" +
+	"-t --theme <emoji|ascii|ansi>\tDraw the warehouse with emoji, the default, with letters or with\n" +
+	"\t\tcoloured letters, for the terminals drawing emoji at the wrong width\n" +
+	"-l --legend\tList the name, the position and the state of every entity under the map\n" +
+	"-s --save <checkpoint> <cycle>\tSave the simulation to checkpoint and stop once cycle is run,\n" +
+	"\t\tor when interrupted with Ctrl-C\n" +
+	"<file>\t\tlaunch the program, the file can be written in the line format or in JSON\n" +
+	"resume <checkpoint> [options]\tResume a saved simulation, with the same continuation\n" +
+	"replay [options] <file> <events>\tReplay the event log of a run of file, checking it's consistent,\n" +
+	"\t\tin the terminal UI with -i, see replay -h for its options\n" +
+	"validate <file> <events>\tCheck the event log of a run of file against every rule of the warehouse\n" +
+	"bench [options] [file...]\tCompare the KPIs of the planners over scenarios or generated warehouses,\n" +
+	"\t\tsee bench -h for its options\n" +
+	"sweep [options] <file>\tRun file over ranges of forklift counts, truck capacities or cooldowns,\n" +
+	"\t\tprinting the KPI curves, see sweep -h for its options\n" +
+	"optimize [options] <file>\tSearch where to place the trucks and the forklifts of file to minimise\n" +
+	"\t\tits makespan, see optimize -h for its options\n" +
+	"generate [options]\tWrite a random warehouse, every package and truck of which can be reached,\n" +
+	"\t\tsee generate -h for its options\n"
 
 func main() {
 	arguments := os.Args
-	graphicMode := false
 
 	if len(arguments) < 2 {
 		_, _ = fmt.Fprint(os.Stderr, helpText)
@@ -28,60 +61,385 @@ func main() {
 	} else if arguments[1] == "-h" || arguments[1] == "--help" {
 		fmt.Printf("%s\n", helpText)
 		return
-	} else if len(arguments) > 2 && (arguments[2] == "-g" || arguments[2] == "--graphic") {
-		graphicMode = true
+	} else if arguments[1] == "generate" {
+		if err := generate(arguments[2:]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		return
+	} else if arguments[1] == "validate" {
+		if err := validate(arguments[2:]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		return
+	} else if arguments[1] == "bench" {
+		if err := bench(arguments[2:]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		return
+	} else if arguments[1] == "sweep" {
+		if err := sweep(arguments[2:]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		return
+	} else if arguments[1] == "optimize" {
+		if err := optimize(arguments[2:]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		return
+	} else if arguments[1] == "replay" {
+		if err := replay(arguments[2:]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		return
 	}
 
-	file, err := os.Open(arguments[1])
+	resuming := arguments[1] == "resume"
+	first := 2
+	if resuming {
+		if len(arguments) < 3 {
+			_, _ = fmt.Fprint(os.Stderr, helpText)
+			os.Exit(1)
+		}
+		first = 3
+	}
+	opts, err := parseOptions(arguments[first:])
 	if err != nil {
 		fmt.Println("😱")
-		_, _ = fmt.Fprint(os.Stderr, err)
+		log.Fatal(err)
+	}
+
+	var simulation *warehouse.Simulation
+	if resuming {
+		if simulation, err = loadCheckpoint(arguments[2]); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+	} else {
+		file, err := os.Open(arguments[1])
+		if err != nil {
+			fmt.Println("😱")
+			_, _ = fmt.Fprint(os.Stderr, err)
+			return
+		}
+
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+
+		initWr, cycles, err := parseScenarioFile(file)
+		if err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+		simulation = warehouse.NewSimulation(initWr, cycles, opts.planner)
+	}
+	if resuming && opts.plannerSet {
+		simulation.Planner = opts.planner
+	}
+	initWr, cycles := simulation.Warehouse, simulation.Cycles
+	if opts.convertPath != "" {
+		if err = writeScenarioFile(opts.convertPath, initWr, cycles); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
 		return
 	}
 
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
+	// The events and metrics streamed to the standard output replace the prose
+	output := io.Writer(os.Stdout)
+	var events *eventLog
+	var metrics *metricsWriter
+	if opts.eventsPath != "" {
+		file := createOutput(opts.eventsPath)
+		defer closeOutput(file)
+		events = newEventLog(file)
+	}
+	if opts.metricsPath != "" {
+		file := createOutput(opts.metricsPath)
+		defer closeOutput(file)
+		metrics = newMetricsWriter(file)
+	}
+	if opts.eventsPath == "-" || opts.metricsPath == "-" {
+		output = io.Discard
+	}
 
-	initWr, cycles, err := parseInputFile(file)
-	if err != nil {
-		fmt.Println("😱")
-		log.Fatal(err)
+	statistics := newRunStatistics()
+	heat := newHeatmap(initWr.Clone())
+	var validator *validator
+	if opts.validation {
+		validator = newValidator(initWr.Clone(), simulation.Cycle)
 	}
 
-	ch := make(chan warehouse.CycleState)
+	// Ctrl-C saves the simulation instead of stopping the program right away
+	interrupt := make(chan os.Signal, 1)
+	if opts.savePath != "" {
+		signal.Notify(interrupt, os.Interrupt)
+	}
 
-	go warehouse.CleanWarehouse(initWr, ch, cycles)
+	// step runs a cycle, writing it to every output, the violations found by the validator being printed on the
+	// standard error or kept in violations for the interactive mode to show them in its event log
+	var summary putAwaySummary
+	var violations []string
+	step := func() warehouse.CycleState {
+		state := simulation.Step()
+		if events != nil {
+			if err = events.write(simulation.Cycle, state); err != nil {
+				fmt.Println("😱")
+				log.Fatal(err)
+			}
+		}
+		if validator != nil {
+			for _, violation := range validator.check(state.Events) {
+				if opts.interactive {
+					violations = append(violations, violation.String())
+				} else {
+					_, _ = fmt.Fprintln(os.Stderr, violation)
+				}
+			}
+		}
+		if metrics != nil {
+			if err = metrics.write(simulation.Cycle, state); err != nil {
+				fmt.Println("😱")
+				log.Fatal(err)
+			}
+		}
+		_, _ = fmt.Fprintf(output, "tour %d/%d\n", simulation.Cycle, cycles)
+		_, _ = fmt.Fprintln(output, opts.show(state))
+		summary.add(state)
+		statistics.add(simulation.Cycle, state)
+		heat.add(state)
+		return state
+	}
 
-	currentCycle := 1
-	for state := range ch {
-		fmt.Printf("tour %d/%d\n", currentCycle, cycles)
-		fmt.Println(showableWarehouse(state))
-		currentCycle++
+	if opts.interactive {
+		output = io.Discard
+		err = runTUI(initWr.Clone(), cycles, 0, opts.theme, func() (warehouse.CycleState, []string, bool) {
+			if simulation.IsOver() {
+				return warehouse.CycleState{}, nil, false
+			}
+			state := step()
+			found := violations
+			violations = nil
+			return state, found, true
+		})
+		if err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+	}
+	for !opts.interactive && !simulation.IsOver() {
+		if opts.savePath != "" && (simulation.Cycle >= opts.saveCycle || interrupted(interrupt)) {
+			if err = saveCheckpoint(opts.savePath, simulation); err != nil {
+				fmt.Println("😱")
+				log.Fatal(err)
+			}
+			_, _ = fmt.Fprintf(output, "saved at tour %d/%d\n", simulation.Cycle, cycles)
+			return
+		}
+		step()
+	}
+	signal.Stop(interrupt)
+
+	if initWr.Mission == warehouse.PutAway {
+		_, _ = fmt.Fprintln(output, summary)
+	}
+	if opts.kpis != "" {
+		if err = statistics.report().write(os.Stdout, opts.kpis); err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+	}
+	if opts.heatmapPath == "-" {
+		fmt.Print(heat.ansi())
+	} else if opts.heatmapPath != "" {
+		file := createOutput(opts.heatmapPath)
+		err = heat.writePNG(file)
+		closeOutput(file)
+		if err != nil {
+			fmt.Println("😱")
+			log.Fatal(err)
+		}
+	}
+
+	if opts.interactive {
+		return
 	}
 
-	if currentCycle < int(cycles) {
-		fmt.Println("😎")
+	if simulation.Cycle+1 < cycles {
+		_, _ = fmt.Fprintln(output, "😎")
 	} else {
-		if graphicMode {
-			fmt.Print("!Warning: to active the graphic mode, the size of the map must not exceed 6x8\n\n")
+		if opts.graphicMode {
+			_, _ = fmt.Fprint(output, "!Warning: to active the graphic mode, the size of the map must not exceed 6x8\n\n")
 		}
 		// TUI
 		ch := make(chan warehouse.CycleState)
 
-		go warehouse.CleanWarehouse(initWr, ch, cycles)
+		go warehouse.CleanWarehouse(initWr, ch, cycles, simulation.Planner)
 
 		currentCycle := 1
 		for state := range ch {
-			fmt.Printf("tour %d/%d\n", currentCycle, cycles)
-			fmt.Println(showableWarehouse(state))
+			_, _ = fmt.Fprintf(output, "tour %d/%d\n", currentCycle, cycles)
+			_, _ = fmt.Fprintln(output, opts.show(state))
 			currentCycle++
 		}
 		if currentCycle < int(cycles) {
-			fmt.Println("😎")
+			_, _ = fmt.Fprintln(output, "😎")
 		} else {
-			fmt.Println("🙂")
+			_, _ = fmt.Fprintln(output, "🙂")
 		}
 	}
 
 }
+
+// options the options following the input file
+// graphicMode activates the graphic mode
+// convertPath the file the scenario is converted to
+// savePath the checkpoint the simulation is saved to once saveCycle is run
+// eventsPath the file the events are written to as JSON Lines, - for the standard output
+// metricsPath the file the metrics of every cycle are written to as CSV, - for the standard output
+// validation checks the events while the simulation runs
+// kpis the format the KPIs are printed in at the end of the run, text or json, none when empty
+// heatmapPath the PNG file the heatmap is drawn to at the end of the run, - to print it on the terminal
+// planner the algorithm finding the paths, plannerSet telling if it was given to replace the one of a checkpoint
+// interactive shows the simulation in a full-screen terminal UI
+// theme how the warehouse is drawn, with emoji by default
+// legend lists the entities under the map
+type options struct {
+	graphicMode bool
+	convertPath string
+	savePath    string
+	saveCycle   uint
+	eventsPath  string
+	metricsPath string
+	validation  bool
+	kpis        string
+	heatmapPath string
+	planner     warehouse.Planner
+	plannerSet  bool
+	interactive bool
+	theme       theme
+	legend      bool
+}
+
+var nameToPlanner = map[string]warehouse.Planner{
+	"dfs":      warehouse.DepthFirst,
+	"dijkstra": warehouse.Dijkstra,
+}
+
+func parseOptions(arguments []string) (opts options, err error) {
+	for index := 0; index < len(arguments); index++ {
+		option := arguments[index]
+		// values the number of values following the option
+		values := 0
+		switch option {
+		case "-c", "--convert", "-e", "--events", "-m", "--metrics", "-k", "--kpis",
+			"-H", "--heatmap", "-p", "--planner", "-t", "--theme":
+			values = 1
+		case "-s", "--save":
+			values = 2
+		}
+		if index+values >= len(arguments) {
+			err = fmt.Errorf("option %s expects %d values", option, values)
+			return
+		}
+
+		switch option {
+		case "-g", "--graphic":
+			opts.graphicMode = true
+		case "-v", "--validate":
+			opts.validation = true
+		case "-i", "--interactive":
+			opts.interactive = true
+		case "-l", "--legend":
+			opts.legend = true
+		case "-c", "--convert":
+			opts.convertPath = arguments[index+1]
+		case "-e", "--events":
+			opts.eventsPath = arguments[index+1]
+		case "-m", "--metrics":
+			opts.metricsPath = arguments[index+1]
+		case "-k", "--kpis":
+			opts.kpis = arguments[index+1]
+			if opts.kpis != "text" && opts.kpis != "json" {
+				err = fmt.Errorf("invalid KPI format %q, expected text or json", opts.kpis)
+				return
+			}
+		case "-H", "--heatmap":
+			opts.heatmapPath = arguments[index+1]
+		case "-p", "--planner":
+			planner, exists := nameToPlanner[strings.ToLower(arguments[index+1])]
+			if !exists {
+				err = fmt.Errorf("unknown planner %q, expected dfs or dijkstra", arguments[index+1])
+				return
+			}
+			opts.planner, opts.plannerSet = planner, true
+		case "-t", "--theme":
+			theme, exists := nameToTheme[strings.ToLower(arguments[index+1])]
+			if !exists {
+				err = fmt.Errorf("unknown theme %q, expected emoji, ascii or ansi", arguments[index+1])
+				return
+			}
+			opts.theme = theme
+		case "-s", "--save":
+			cycle, parseErr := strconv.ParseUint(arguments[index+2], 10, 0)
+			if parseErr != nil {
+				err = fmt.Errorf("invalid cycle %q to save the simulation at", arguments[index+2])
+				return
+			}
+			opts.savePath, opts.saveCycle = arguments[index+1], uint(cycle)
+		default:
+			err = fmt.Errorf("unknown option %s", option)
+			return
+		}
+		index += values
+	}
+	if opts.interactive && (opts.savePath != "" || opts.eventsPath == "-" || opts.metricsPath == "-") {
+		err = errors.New("the interactive mode can't save the simulation nor write to the standard output")
+	}
+	return
+}
+
+// show the events of a cycle and the warehouse, drawn in the theme of the options and followed by its legend if
+// asked
+func (opts options) show(state warehouse.CycleState) string {
+	sw := showableWarehouse(state)
+	if opts.legend {
+		return sw.themed(opts.theme) + sw.legend(opts.theme)
+	}
+	return sw.themed(opts.theme)
+}
+
+// createOutput creates the file an output is written to, the standard output for -
+func createOutput(path string) *os.File {
+	if path == "-" {
+		return os.Stdout
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Println("😱")
+		log.Fatal(err)
+	}
+	return file
+}
+
+func closeOutput(file *os.File) {
+	if file != os.Stdout {
+		_ = file.Close()
+	}
+}
+
+// interrupted checks if the program was interrupted with Ctrl-C, without waiting for it
+func interrupted(interrupt chan os.Signal) bool {
+	select {
+	case <-interrupt:
+		return true
+	default:
+		return false
+	}
+}
@@ -22,16 +22,29 @@ func generateMainLoop(initWr warehouse.Warehouse, cycles uint) func() {
 	return func() {
 		ch := make(chan warehouse.CycleState)
 
-		go warehouse.CleanWarehouse(initWr, ch, cycles)
+		go warehouse.CleanWarehouse(initWr, ch, cycles, warehouse.DepthFirst)
 
 		var gr Graphical
 		gr.CreateWindow()
+		gr.SetLayout(initWr.Height, initWr.Neighbourhood == warehouse.Hexagonal)
 		gr.CreateText("tour", 0.5, 0.25)
-		for y := 1; y <= int(initWr.Height); y += 1 {
-			for x := 1; x <= int(initWr.Length); x += 1 {
-				gr.CreateRectangle(strconv.Itoa(y)+"/"+strconv.Itoa(x), x, y)
+		// Floors are drawn side by side
+		for floor := 0; floor < initWr.FloorCount(); floor++ {
+			for y := 1; y <= int(initWr.Height); y += 1 {
+				for x := 1; x <= int(initWr.Length); x += 1 {
+					column := floorColumn(initWr, warehouse.Position{X: x, Floor: floor})
+					id := strconv.Itoa(floor) + "/" + strconv.Itoa(y) + "/" + strconv.Itoa(x)
+					if initWr.Walls[warehouse.Position{X: x - 1, Y: int(initWr.Height) - y, Floor: floor}] {
+						gr.CreateWall(id, column, y)
+					} else {
+						gr.CreateRectangle(id, column, y)
+					}
+				}
 			}
 		}
+		for pos, exits := range initWr.Exits {
+			gr.CreateArrow(exits, floorColumn(initWr, pos)+1, int(initWr.Height)-pos.Y)
+		}
 
 		currentCycle := 1
 		for !gr.IsWindowClosed() {
@@ -43,6 +56,7 @@ func generateMainLoop(initWr warehouse.Warehouse, cycles uint) func() {
 				gr.ClearWindow()
 				gr.ChangeText("tour", "tour "+strconv.Itoa(currentCycle))
 				gr.DisplayRectangle("all")
+				gr.DisplayArrows()
 				gr.DisplayText("all")
 				gr.DisplayEntity("all")
 
@@ -66,17 +80,30 @@ func generateMainLoop(initWr warehouse.Warehouse, cycles uint) func() {
 func placeEntities(initWr warehouse.Warehouse, gr *Graphical) {
 	gr.ClearEntities()
 	for pos, trucks := range initWr.Trucks {
-		gr.CreateEntity(trucks.Name, pos.X, int(initWr.Height)-pos.Y)
+		gr.CreateEntity(trucks.Name, floorColumn(initWr, pos), int(initWr.Height)-pos.Y)
 		gr.AddEntityInformation(trucks.Name, fmt.Sprintf("%d/%d\n", trucks.CurrentWeight, trucks.MaxWeight))
 	}
+	for pos, rack := range initWr.Racks {
+		gr.CreateEntity(rack.Name, floorColumn(initWr, pos), int(initWr.Height)-pos.Y)
+		gr.AddEntityInformation(rack.Name, fmt.Sprintf("%d/%d\n", len(rack.Stack), rack.Slots))
+	}
+	for _, order := range initWr.Orders {
+		gr.CreateEntity(order.Name, floorColumn(initWr, order.Staging), int(initWr.Height)-order.Staging.Y)
+		gr.AddEntityInformation(order.Name, fmt.Sprintf("%d/%d\n", len(order.Staged), len(order.Packages)))
+	}
 	for pos, packages := range initWr.Packages {
-		gr.CreateEntity(packages.Name, pos.X, int(initWr.Height)-pos.Y)
+		gr.CreateEntity(packages.Name, floorColumn(initWr, pos), int(initWr.Height)-pos.Y)
 	}
 	for pos, forklifts := range initWr.ForkLifts {
-		gr.CreateEntity(forklifts.Name, pos.X, int(initWr.Height)-pos.Y)
+		gr.CreateEntity(forklifts.Name, floorColumn(initWr, pos), int(initWr.Height)-pos.Y)
 	}
 }
 
+// floorColumn gives the column of a Position once the floors are drawn side by side, separated by an empty column
+func floorColumn(wr warehouse.Warehouse, pos warehouse.Position) int {
+	return pos.Floor*(wr.Length+1) + pos.X
+}
+
 type GraphicalEntity struct {
 	text  *text.Text
 	rect  *imdraw.IMDraw
@@ -85,9 +112,12 @@ type GraphicalEntity struct {
 
 type Graphical struct {
 	yRatio, xRatio float64
+	height         int
+	hexagonal      bool
 	win            *pixelgl.Window
 	texts          map[string]*text.Text
 	rects          map[string]*imdraw.IMDraw
+	arrows         []*text.Text
 	entities       map[string]GraphicalEntity
 }
 
@@ -115,6 +145,19 @@ func (g *Graphical) CreateWindow() {
 	g.yRatio = 100
 }
 
+// SetLayout gives the height of the grid and whether its odd rows are shifted as in an hexagonal grid
+func (g *Graphical) SetLayout(height int, hexagonal bool) {
+	g.height = height
+	g.hexagonal = hexagonal
+}
+
+func (g *Graphical) rowShift(y int) float64 {
+	if g.hexagonal && (g.height-y)%2 != 0 {
+		return 0.5
+	}
+	return 0
+}
+
 func (g *Graphical) ClearWindow() {
 	g.win.Clear(pixel.RGB(0, 0.2, 0.2))
 }
@@ -182,18 +225,27 @@ func (g *Graphical) DisplayText(id string) bool {
 // ####### RECTANGLE #######
 // #########################
 func (g *Graphical) CreateRectangle(id string, x int, y int) bool {
+	return g.createTile(id, x, y, pixel.RGB(0, 0, 0))
+}
+
+// CreateWall creates a tile filled like the grid lines, nothing goes through it
+func (g *Graphical) CreateWall(id string, x int, y int) bool {
+	return g.createTile(id, x, y, pixel.RGB(0.5, 0.5, 0.5))
+}
+
+func (g *Graphical) createTile(id string, x int, y int, fill pixel.RGBA) bool {
 	_, exists := g.rects[id]
 	if exists {
 		return false
 	}
-	real_x := float64(x) * g.xRatio
+	real_x := (float64(x) + g.rowShift(y)) * g.xRatio
 	real_y := float64(y) * g.yRatio
 	rect := imdraw.New(nil)
 	rect.Color = pixel.RGB(0.5, 0.5, 0.5)
 	rect.Push(pixel.V(real_x, real_y))
 	rect.Push(pixel.V(real_x+g.xRatio, real_y+g.yRatio))
 	rect.Rectangle(3)
-	rect.Color = pixel.RGB(0, 0, 0)
+	rect.Color = fill
 	rect.Push(pixel.V(real_x, real_y))
 	rect.Push(pixel.V(real_x+g.xRatio, real_y+g.yRatio))
 	rect.Rectangle(0)
@@ -216,6 +268,42 @@ func (g *Graphical) DisplayRectangle(id string) bool {
 	return true
 }
 
+// ######################
+// ####### ARROWS #######
+// ######################
+func (g *Graphical) CreateArrow(exits warehouse.Exits, x int, y int) bool {
+	arrows := map[warehouse.Exits]string{
+		warehouse.ExitUp:        "^",
+		warehouse.ExitRight:     ">",
+		warehouse.ExitDown:      "v",
+		warehouse.ExitLeft:      "<",
+		warehouse.ExitUpRight:   "^>",
+		warehouse.ExitDownRight: "v>",
+		warehouse.ExitDownLeft:  "<v",
+		warehouse.ExitUpLeft:    "<^",
+	}
+	arrow := "+"
+	if flow, ok := exits.Flow(); ok {
+		arrow = arrows[flow]
+	}
+
+	txt := text.New(pixel.V((float64(x)+0.5+g.rowShift(y))*g.xRatio, (float64(y)+0.5)*g.yRatio), text.NewAtlas(basicfont.Face7x13, text.ASCII))
+	if txt == nil {
+		return false
+	}
+	txt.Color = pixel.RGB(0.5, 0.5, 0.5)
+	txt.Dot.X -= txt.BoundsOf(arrow).W() / 2
+	_, _ = fmt.Fprintln(txt, arrow)
+	g.arrows = append(g.arrows, txt)
+	return true
+}
+
+func (g *Graphical) DisplayArrows() {
+	for _, arrow := range g.arrows {
+		arrow.Draw(g.win, pixel.IM.Scaled(arrow.Orig, 4))
+	}
+}
+
 // ######################
 // ####### ENTITY #######
 // ######################
@@ -227,7 +315,7 @@ func (g *Graphical) CreateEntity(id string, x int, y int) bool {
 	} else {
 		entityColor = pixel.RGB(rand.Float64(), rand.Float64(), rand.Float64())
 	}
-	txt := text.New(pixel.V((float64(x+1)+0.5)*g.xRatio, (float64(y)+0.5)*g.yRatio), text.NewAtlas(basicfont.Face7x13, text.ASCII))
+	txt := text.New(pixel.V((float64(x+1)+0.5+g.rowShift(y))*g.xRatio, (float64(y)+0.5)*g.yRatio), text.NewAtlas(basicfont.Face7x13, text.ASCII))
 	if txt == nil {
 		return false
 	}
@@ -235,7 +323,7 @@ func (g *Graphical) CreateEntity(id string, x int, y int) bool {
 	txt.Dot.X -= txt.BoundsOf(id).W() / 2
 	_, _ = fmt.Fprintln(txt, id)
 
-	real_x := float64(x+1) * g.xRatio
+	real_x := (float64(x+1) + g.rowShift(y)) * g.xRatio
 	real_y := float64(y) * g.yRatio
 	rect := imdraw.New(nil)
 	rect.Color = pixel.RGB(0.5, 0.5, 0.5)
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// heatTile the size in pixels of a tile of the PNG heatmap, and of the margins around its grids
+const heatTile = 16
+
+var (
+	wallColor     = color.RGBA{R: 60, G: 60, B: 60, A: 255}
+	fixtureColor  = color.RGBA{R: 100, G: 130, B: 190, A: 255}
+	untouchedTile = color.RGBA{R: 235, G: 235, B: 235, A: 255}
+)
+
+// heatmap counts the ForkLift visiting and waiting on every tile during a run, to spot the congested aisles
+// warehouse the Warehouse at the start of the run, telling its walls, trucks, racks and staging tiles
+// visits the number of times a ForkLift moved into every tile
+// waits the number of cycles a ForkLift waited on every tile
+type heatmap struct {
+	warehouse Warehouse
+	visits    map[Position]int
+	waits     map[Position]int
+}
+
+func newHeatmap(wh Warehouse) *heatmap {
+	return &heatmap{warehouse: wh, visits: make(map[Position]int), waits: make(map[Position]int)}
+}
+
+func (heat *heatmap) add(state CycleState) {
+	for _, event := range state.Events {
+		switch event := event.(type) {
+		case ForkliftMove:
+			heat.visits[event.ToPosition()]++
+		case ForkliftWait:
+			heat.waits[event.AtPosition()]++
+		}
+	}
+}
+
+// isFixture checks if a tile holds something a ForkLift can't go through for the whole run
+func (heat *heatmap) isFixture(pos Position) bool {
+	wh := heat.warehouse
+	return wh.Trucks.Exists(pos) || wh.Racks.Exists(pos) || wh.StagingAt(pos) != -1
+}
+
+// tileColor the colour of a tile counted in a layer of the heatmap, from pale yellow to dark red as it gets
+// closer to the highest count, walls and fixtures having their own colours
+func (heat *heatmap) tileColor(counts map[Position]int, highest int, pos Position) color.RGBA {
+	switch {
+	case heat.warehouse.Walls[pos]:
+		return wallColor
+	case heat.isFixture(pos):
+		return fixtureColor
+	case counts[pos] == 0:
+		return untouchedTile
+	}
+	ratio := float64(counts[pos]) / float64(highest)
+	return color.RGBA{
+		R: uint8(255 - 80*ratio),
+		G: uint8(230 * (1 - ratio)),
+		B: uint8(120 * (1 - ratio)),
+		A: 255,
+	}
+}
+
+// highestCount the highest count of a layer of the heatmap, 1 when nothing was counted
+func highestCount(counts map[Position]int) int {
+	highest := 1
+	for _, count := range counts {
+		if count > highest {
+			highest = count
+		}
+	}
+	return highest
+}
+
+// ansi renders the visits and the waits as grids coloured with ANSI escape codes, followed by the most waited
+// on tiles
+func (heat *heatmap) ansi() string {
+	output := heat.ansiLayer("visits", heat.visits) + heat.ansiLayer("waits", heat.waits)
+
+	positions := SortedPositions(heat.waits)
+	sort.SliceStable(positions, func(i, j int) bool {
+		return heat.waits[positions[i]] > heat.waits[positions[j]]
+	})
+	if len(positions) > 5 {
+		positions = positions[:5]
+	}
+	tiles := make([]string, 0, len(positions))
+	for _, pos := range positions {
+		tiles = append(tiles, fmt.Sprintf("%s %d", showableWarehouse{Warehouse: heat.warehouse}.position(pos),
+			heat.waits[pos]))
+	}
+	if len(tiles) != 0 {
+		output += "most waited on tiles: " + strings.Join(tiles, ", ") + "\n"
+	}
+	return output
+}
+
+func (heat *heatmap) ansiLayer(name string, counts map[Position]int) string {
+	wh := heat.warehouse
+	highest := highestCount(counts)
+	output := fmt.Sprintf("%s, up to %d per tile\n", name, highest)
+
+	for floor := 0; floor < wh.FloorCount(); floor++ {
+		if wh.FloorCount() > 1 {
+			output += fmt.Sprintf("level %d\n", floor)
+		}
+		for y := 0; y < wh.Height; y++ {
+			output += strings.Repeat(" ", wh.RowShift(y))
+			for x := 0; x < wh.Length; x++ {
+				pos := Position{X: x, Y: y, Floor: floor}
+				tile := heat.tileColor(counts, highest, pos)
+				output += fmt.Sprintf("\x1b[48;2;%d;%d;%dm\x1b[30m%s", tile.R, tile.G, tile.B, countLabel(counts[pos]))
+			}
+			output += "\x1b[0m\n"
+		}
+	}
+	return output
+}
+
+// countLabel the count written on a tile of the ANSI heatmap, on 2 characters
+func countLabel(count int) string {
+	switch {
+	case count == 0:
+		return "  "
+	case count > 99:
+		return "++"
+	default:
+		return fmt.Sprintf("%2d", count)
+	}
+}
+
+// writePNG draws the heatmap as a PNG, the visits on the left and the waits on the right, a row for every floor
+func (heat *heatmap) writePNG(file io.Writer) error {
+	wh := heat.warehouse
+	gridWidth := wh.Length * heatTile
+	if wh.Neighbourhood == Hexagonal {
+		gridWidth += heatTile / 2
+	}
+	gridHeight := wh.Height * heatTile
+	width := 2*gridWidth + 3*heatTile
+	height := wh.FloorCount()*(gridHeight+heatTile) + heatTile
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for layer, counts := range []map[Position]int{heat.visits, heat.waits} {
+		highest := highestCount(counts)
+		for floor := 0; floor < wh.FloorCount(); floor++ {
+			left := heatTile + layer*(gridWidth+heatTile)
+			top := heatTile + floor*(gridHeight+heatTile)
+			heat.drawGrid(img, counts, highest, floor, left, top)
+		}
+	}
+	return png.Encode(file, img)
+}
+
+// drawGrid draws a floor of a layer of the heatmap from its top left corner, leaving a pixel between the tiles
+func (heat *heatmap) drawGrid(img *image.RGBA, counts map[Position]int, highest int, floor int, left int, top int) {
+	wh := heat.warehouse
+	for y := 0; y < wh.Height; y++ {
+		shift := wh.RowShift(y) * heatTile / 2
+		for x := 0; x < wh.Length; x++ {
+			tile := heat.tileColor(counts, highest, Position{X: x, Y: y, Floor: floor})
+			x0, y0 := left+shift+x*heatTile, top+y*heatTile
+			for py := y0; py < y0+heatTile-1; py++ {
+				for px := x0; px < x0+heatTile-1; px++ {
+					img.SetRGBA(px, py, tile)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// metricsWriter writes the metrics of every cycle as a CSV row, the columns being told by a header row
+// trucks the Position of the Truck, giving the order of their columns
+// delivered and deliveredWeight the Package delivered or stored since the first cycle written
+type metricsWriter struct {
+	writer          *csv.Writer
+	started         bool
+	trucks          []Position
+	delivered       int
+	deliveredWeight Weight
+}
+
+func newMetricsWriter(file io.Writer) *metricsWriter {
+	return &metricsWriter{writer: csv.NewWriter(file)}
+}
+
+// write writes the row of a cycle, after the header when it's the first one
+func (metrics *metricsWriter) write(cycle uint, state CycleState) error {
+	wh := state.Warehouse
+	if !metrics.started {
+		metrics.started = true
+		metrics.trucks = SortedPositions(wh.Trucks)
+		header := []string{
+			"cycle", "packages_remaining", "packages_in_transit", "delivered", "delivered_weight",
+			"forklifts_moving", "forklifts_waiting", "forklifts_carrying",
+		}
+		for _, pos := range metrics.trucks {
+			name := wh.Trucks[pos].Name
+			header = append(header, name+"_load", name+"_max_weight", name+"_state")
+		}
+		if err := metrics.writer.Write(header); err != nil {
+			return err
+		}
+	}
+
+	moving, waiting := 0, 0
+	for _, event := range state.Events {
+		switch event := event.(type) {
+		case ForkliftMove:
+			moving++
+		case ForkliftWait:
+			waiting++
+		case DeliverPackage:
+			metrics.delivered++
+			metrics.deliveredWeight += event.PackageWeight()
+		case StorePackage:
+			metrics.delivered++
+			metrics.deliveredWeight += event.PackageWeight()
+		}
+	}
+	carrying := 0
+	for _, forklift := range wh.ForkLifts {
+		if _, isCarrying := forklift.Carrying(); isCarrying {
+			carrying++
+		}
+	}
+
+	row := []string{
+		fmt.Sprint(cycle), fmt.Sprint(remainingPackages(wh)), fmt.Sprint(packagesInTransit(wh)),
+		fmt.Sprint(metrics.delivered), fmt.Sprint(metrics.deliveredWeight), fmt.Sprint(moving), fmt.Sprint(waiting),
+		fmt.Sprint(carrying),
+	}
+	for _, pos := range metrics.trucks {
+		truck := wh.Trucks[pos]
+		truckState := "waiting"
+		if truck.TimeUntilReturn != 0 {
+			truckState = "gone"
+		}
+		row = append(row, fmt.Sprint(truck.CurrentWeight), fmt.Sprint(truck.MaxWeight), truckState)
+	}
+	if err := metrics.writer.Write(row); err != nil {
+		return err
+	}
+	// Every row is flushed for the file to be charted while the simulation runs
+	metrics.writer.Flush()
+	return metrics.writer.Error()
+}
+
+// packagesInTransit counts the Package on the move: carried by a ForkLift, or in the Cargo of a Truck on its way to
+// its dock when putting away
+func packagesInTransit(wh Warehouse) int {
+	inTransit := 0
+	for _, forklift := range wh.ForkLifts {
+		if _, carrying := forklift.Carrying(); carrying {
+			inTransit++
+		}
+	}
+	for _, truck := range wh.Trucks {
+		if truck.TimeUntilReturn != 0 {
+			inTransit += len(truck.Cargo)
+		}
+	}
+	return inTransit
+}
+
+// remainingPackages counts the Package still to be picked up by a ForkLift: on the floor, in the Rack and on the
+// staging tiles when shipping, in the Truck when putting away
+func remainingPackages(wh Warehouse) int {
+	remaining := len(wh.Packages)
+
+	if wh.Mission == PutAway {
+		for _, truck := range wh.Trucks {
+			remaining += len(truck.Cargo)
+		}
+		return remaining
+	}
+	for _, rack := range wh.Racks {
+		remaining += len(rack.Stack)
+	}
+	for _, order := range wh.Orders {
+		remaining += len(order.Staged)
+	}
+	return remaining
+}
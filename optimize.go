@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// optimize runs the optimize subcommand, searching where to place the trucks and the forklifts of a scenario to
+// minimise its makespan by simulated annealing, every placement tried being simulated
+func optimize(arguments []string) error {
+	var plannerName, output string
+	var iterations int
+	var seed int64
+	var timeout time.Duration
+	var trucks, forklifts bool
+	flags := flag.NewFlagSet("optimize", flag.ContinueOnError)
+	flags.IntVar(&iterations, "iterations", 200, "number of placements tried")
+	flags.BoolVar(&trucks, "trucks", true, "move the trucks")
+	flags.BoolVar(&forklifts, "forklifts", true, "move the starting points of the forklifts")
+	flags.StringVar(&plannerName, "planner", "dfs", "planner finding the paths, dfs or dijkstra")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "time after which a placement is given up, never when 0")
+	flags.Int64Var(&seed, "seed", 0, "seed of the search, random when 0")
+	flags.StringVar(&output, "o", "", "output file of the best scenario, in JSON if it ends with .json, the standard output otherwise")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gotrans optimize [options] <scenario>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); errors.Is(err, flag.ErrHelp) {
+		// The usage asked for is printed by the flags
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("optimize expects a scenario")
+	}
+	if !trucks && !forklifts {
+		return errors.New("optimize expects the trucks or the forklifts to be moved")
+	}
+	planner, exists := nameToPlanner[strings.ToLower(plannerName)]
+	if !exists {
+		return fmt.Errorf("unknown planner %q, expected dfs or dijkstra", plannerName)
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		_, _ = fmt.Fprintf(os.Stderr, "seed %d\n", seed)
+	}
+
+	scenarios, err := readBenchScenarios(flags.Args())
+	if err != nil {
+		return err
+	}
+	scenario := scenarios[0]
+	score := func(wh Warehouse) (float64, bool) {
+		result := runBenchScenario(benchScenario{name: "placement", warehouse: wh, cycles: scenario.cycles}, planner, timeout)
+		return layoutScore(result, scenario.cycles)
+	}
+
+	initialScore, finished := score(scenario.warehouse)
+	if !finished {
+		return errors.New("the scenario itself was given up, raise the timeout")
+	}
+	current, currentScore := scenario.warehouse, initialScore
+	best, bestScore := current, currentScore
+	rng := rand.New(rand.NewSource(seed))
+	temperature := math.Max(1, initialScore/10)
+
+	for iteration := 0; iteration < iterations; iteration++ {
+		candidate, moved := relocate(current, rng, trucks, forklifts)
+		if !moved {
+			break
+		}
+		candidateScore, finished := score(candidate)
+		if !finished {
+			continue
+		}
+
+		// Worse placements are accepted less and less often as the search cools down
+		cooling := temperature * (1 - float64(iteration)/float64(iterations))
+		if candidateScore <= currentScore || rng.Float64() < math.Exp((currentScore-candidateScore)/cooling) {
+			current, currentScore = candidate, candidateScore
+		}
+		if currentScore < bestScore {
+			best, bestScore = current, currentScore
+			_, _ = fmt.Fprintf(os.Stderr, "iteration %d: score %.0f\n", iteration+1, bestScore)
+		}
+	}
+
+	summary := fmt.Sprintf("best score %.0f, from %.0f for the scenario\n", bestScore, initialScore)
+	if output == "" {
+		_, _ = fmt.Fprint(os.Stderr, summary)
+		return writeInputFile(os.Stdout, best, scenario.cycles)
+	}
+	fmt.Print(summary)
+	return writeScenarioFile(output, best, scenario.cycles)
+}
+
+// layoutScore the score of a placement minimised by the optimizer: the makespan when the Warehouse is cleaned, the
+// cycles run plus the cycles of the scenario for every Package left otherwise, none when the run is given up
+func layoutScore(result benchResult, cycles uint) (float64, bool) {
+	if result.givenUp {
+		return 0, false
+	}
+	if !result.report.Finished {
+		return float64(result.report.Cycles) + float64(result.report.Remaining)*float64(cycles), true
+	}
+	return float64(result.report.Makespan), true
+}
+
+// relocate moves a random Truck or ForkLift of a Warehouse to an empty tile, next to it most of the time to refine
+// the placement, anywhere otherwise to leave a poor area
+func relocate(wh Warehouse, rng *rand.Rand, trucks bool, forklifts bool) (Warehouse, bool) {
+	var movable []Position
+	if trucks {
+		movable = append(movable, SortedPositions(wh.Trucks)...)
+	}
+	if forklifts {
+		movable = append(movable, SortedPositions(wh.ForkLifts)...)
+	}
+
+	var empty []Position
+	for floor := 0; floor < wh.FloorCount(); floor++ {
+		for y := 0; y < wh.Height; y++ {
+			for x := 0; x < wh.Length; x++ {
+				if pos := (Position{X: x, Y: y, Floor: floor}); isEmptyTile(wh, pos) {
+					empty = append(empty, pos)
+				}
+			}
+		}
+	}
+	if len(movable) == 0 || len(empty) == 0 {
+		return wh, false
+	}
+
+	from := movable[rng.Intn(len(movable))]
+	var nearby []Position
+	for _, pos := range sideNeighbours(from) {
+		if isEmptyTile(wh, pos) {
+			nearby = append(nearby, pos)
+		}
+	}
+	to := empty[rng.Intn(len(empty))]
+	if len(nearby) != 0 && rng.Float64() < 0.7 {
+		to = nearby[rng.Intn(len(nearby))]
+	}
+
+	moved := wh.Clone()
+	if truck, isTruck := moved.Trucks[from]; isTruck {
+		delete(moved.Trucks, from)
+		moved.Trucks[to] = truck
+	} else {
+		forklift := moved.ForkLifts[from]
+		delete(moved.ForkLifts, from)
+		moved.ForkLifts[to] = forklift
+	}
+	return moved, true
+}
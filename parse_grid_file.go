@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+const (
+	gridForm   = "grid <cycles>"
+	legendForm = "<symbol> <name> [<yellow|green|blue> | <max weight> <cooldown>]"
+	wallSymbol = '#'
+	// floorSymbol an empty tile, spaces are empty tiles too
+	floorSymbol = '.'
+)
+
+// gridRow a row of the grid drawn in the input file
+type gridRow struct {
+	number int
+	tiles  []rune
+}
+
+// gridSymbol a symbol drawn in the grid, waiting for the legend telling what it stands for
+type gridSymbol struct {
+	pos    Position
+	line   int
+	column int
+}
+
+// isGridFile checks if the content of an input file starts with a grid header
+func isGridFile(content []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for number := 1; scanner.Scan(); number++ {
+		line := splitLine(number, scanner.Text())
+		if len(line.words) != 0 {
+			return line.words[0].text == "grid"
+		}
+	}
+	return false
+}
+
+func parseGridFile(file io.Reader) (warehouse Warehouse, cycles uint, err error) {
+	scanner := &inputScanner{Scanner: bufio.NewScanner(file), floors: 1}
+
+	if !scanner.Scan() {
+		if err = scanner.Err(); err == nil {
+			err = parseError{scanner.number + 1, 1, "missing grid, expected " + gridForm}
+		}
+		return
+	}
+	header := scanner.line
+	if cycles, err = parseGridHeader(header); err != nil {
+		return
+	}
+
+	floors, err := scanGrid(scanner)
+	if err != nil {
+		return
+	}
+	length, height := gridSize(floors)
+	if length == 0 {
+		err = header.wrap(errors.New("the grid should have at least a tile"))
+		return
+	}
+	warehouse = newWarehouse(length, height)
+	warehouse.Floors = scanner.floors
+
+	symbols := make(map[rune][]gridSymbol)
+	for floor, rows := range floors {
+		for y, row := range rows {
+			for x, tile := range row.tiles {
+				pos := Position{X: x, Y: y, Floor: floor}
+				switch tile {
+				case wallSymbol:
+					warehouse.Walls[pos] = true
+				case floorSymbol, ' ':
+				default:
+					symbols[tile] = append(symbols[tile], gridSymbol{pos: pos, line: row.number, column: x + 1})
+				}
+			}
+		}
+	}
+
+	// The legend and the directives follow the grid
+	for scanner.Scan() {
+		line := scanner.line
+		keyword := line.words[0].text
+
+		if utf8.RuneCountInString(keyword) == 1 {
+			err = parseLegend(line, symbols, &warehouse)
+		} else if parse, exists := directiveParsers[keyword]; exists {
+			if scanner.floors > warehouse.Floors {
+				warehouse.Floors = scanner.floors
+			}
+			err = parse(line, scanner, &warehouse)
+		} else {
+			err = line.errorAt(0, legendForm+" or a directive")
+		}
+		if err != nil {
+			return
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if err = unknownSymbol(symbols); err != nil {
+		return
+	}
+	err = scanner.finish(&warehouse)
+	return
+}
+
+func parseGridHeader(line inputLine) (cycles uint, err error) {
+	if err = line.expectWords(gridForm, 2, 2); err != nil {
+		return
+	}
+	numbers, err := line.numbers(gridForm, 1, 1)
+	if err != nil {
+		return
+	}
+	if numbers[0] < 0 {
+		err = line.errorAt(1, gridForm)
+		return
+	}
+	cycles = uint(numbers[0])
+	err = line.wrapAt(1, checkCycles(cycles))
+	return
+}
+
+// scanGrid reads the rows of every floor of the grid, up to the legend header or the end of the file
+func scanGrid(scanner *inputScanner) ([][]gridRow, error) {
+	floors := make([][]gridRow, 1)
+
+	for scanner.Scanner.Scan() {
+		scanner.number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		line := splitLine(scanner.number, text)
+		if len(line.words) == 1 && line.words[0].text == "legend" {
+			return floors, nil
+		}
+		if len(line.words) != 0 && line.words[0].text == "level" {
+			if err := parseLevel(line, scanner, nil); err != nil {
+				return nil, err
+			}
+			for len(floors) < scanner.floors {
+				floors = append(floors, nil)
+			}
+			continue
+		}
+
+		tiles := []rune(text)
+		if len(line.words) != 0 {
+			// The row ends with its last word, leaving out its comment
+			last := line.words[len(line.words)-1]
+			tiles = tiles[:last.column-1+utf8.RuneCountInString(last.text)]
+		} else if text == "" || strings.TrimSpace(text) != "" {
+			// Only the empty lines and the comments are skipped, a row of spaces being a row of empty tiles
+			continue
+		}
+		for column, tile := range tiles {
+			if tile != ' ' && unicode.IsSpace(tile) {
+				return nil, parseError{scanner.number, column + 1, fmt.Sprintf(
+					"%q can't be drawn in the grid, expected a space or %q for an empty tile", tile, floorSymbol)}
+			}
+		}
+		floors[scanner.level] = append(floors[scanner.level], gridRow{number: scanner.number, tiles: tiles})
+	}
+	return floors, scanner.Err()
+}
+
+// unknownSymbol reports the first symbol drawn in the grid but missing from the legend, if any
+func unknownSymbol(symbols map[rune][]gridSymbol) error {
+	var first *gridSymbol
+	var firstSymbol rune
+
+	for symbol, places := range symbols {
+		if first == nil || places[0].line < first.line || (places[0].line == first.line && places[0].column < first.column) {
+			first = &places[0]
+			firstSymbol = symbol
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return parseError{first.line, first.column, fmt.Sprintf(
+		"symbol %q missing from the legend, expected %q for a wall, %q or a space for the floor, or a symbol of the legend",
+		firstSymbol, wallSymbol, floorSymbol)}
+}
+
+// gridSize returns the length of the longest row and the height of the highest floor, shorter ones being padded
+// with empty tiles
+func gridSize(floors [][]gridRow) (length int, height int) {
+	for _, rows := range floors {
+		if len(rows) > height {
+			height = len(rows)
+		}
+		for _, row := range rows {
+			if len(row.tiles) > length {
+				length = len(row.tiles)
+			}
+		}
+	}
+	return
+}
+
+// parseLegend gives a name to every entity drawn with a symbol, numbering them in reading order when the symbol is
+// drawn several times, the kind of the entity is told by the number of words of the legend
+func parseLegend(line inputLine, symbols map[rune][]gridSymbol, warehouse *Warehouse) error {
+	if err := line.expectWords(legendForm, 2, 4); err != nil {
+		return err
+	}
+	symbol, _ := utf8.DecodeRuneInString(line.words[0].text)
+	places, drawn := symbols[symbol]
+	if !drawn {
+		return line.wrap(fmt.Errorf("symbol %q isn't drawn in the grid, or already has a legend", symbol))
+	}
+	delete(symbols, symbol)
+
+	var weight Weight
+	var numbers []int
+	var err error
+	switch len(line.words) {
+	case 3:
+		var ok bool
+		if weight, ok = colorToWeight[strings.ToLower(line.words[2].text)]; !ok {
+			return line.errorAt(2, legendForm)
+		}
+	case 4:
+		if numbers, err = line.numbers(legendForm, 2, 2); err != nil {
+			return err
+		}
+	}
+
+	for index, place := range places {
+		name := line.words[1].text
+		if len(places) > 1 {
+			name = fmt.Sprintf("%s_%d", name, index+1)
+		}
+		if err = placeEntity(warehouse, place.pos); err != nil {
+			return parseError{place.line, place.column, err.Error()}
+		}
+
+		switch len(line.words) {
+		case 2:
+			warehouse.ForkLifts[place.pos] = ForkLift{Name: name}
+		case 3:
+			warehouse.Packages[place.pos] = Package{Name: name, Weight: weight}
+		case 4:
+			warehouse.Trucks[place.pos] = Truck{Name: name, MaxWeight: Weight(numbers[0]), ElapseDischargingTime: numbers[1]}
+		}
+	}
+	return nil
+}
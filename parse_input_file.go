@@ -2,158 +2,1012 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	. "github.com/Harmos274/gotrans/warehouse"
 )
 
-func parseInputFile(file *os.File) (warehouse Warehouse, cycles uint, err error) {
-	scanner := bufio.NewScanner(file)
+// inputScanner scans the meaningful lines of the input file, skipping blank lines and comments
+// number the number of the last line read in the file
+// line the last meaningful line read
+// level the floor described by the next lines, given by the last `level` line
+// floors the number of floors described so far
+// section the section of the next entity lines
+// explicit if the section was given by a header rather than guessed from the lines
+// deferred the checks that need the whole file to be read, run in order once it is
+// orders the lines of the orders, resolved once everything else is
+type inputScanner struct {
+	*bufio.Scanner
+	number   int
+	line     inputLine
+	level    int
+	floors   int
+	section  section
+	explicit bool
+	deferred []func() error
+	orders   []inputLine
+}
 
-	if scanner.Scan() {
-		warehouse, cycles, err = parseWarehouse(scanner.Text())
-		if err != nil {
-			return
+// Scan advances to the next line that is neither blank nor a comment
+func (scanner *inputScanner) Scan() bool {
+	for scanner.Scanner.Scan() {
+		scanner.number++
+		line := splitLine(scanner.number, scanner.Text())
+		if len(line.words) != 0 {
+			scanner.line = line
+			return true
 		}
-	} else {
-		err = errors.New("invalid file format")
-		return
 	}
+	return false
+}
 
-	for scanner.Scan() {
-		words := strings.Split(scanner.Text(), " ")
-
-		if len(words) != 4 {
-			break
-		}
-		pack, pos, packErr := parsePackage(words)
-
-		if packErr != nil {
-			err = packErr
-			return
+// finish completes the Warehouse once the whole file is read
+func (scanner *inputScanner) finish(warehouse *Warehouse) error {
+	if scanner.floors > warehouse.Floors {
+		warehouse.Floors = scanner.floors
+	}
+	for _, check := range scanner.deferred {
+		if err := check(); err != nil {
+			return err
 		}
-		if warehouse.SomethingExistsAt(pos) {
-			err = errors.New("two entities can't be at the same position")
-			return
+	}
+	for index, line := range scanner.orders {
+		if err := resolveOrder(warehouse, &warehouse.Orders[index]); err != nil {
+			return line.wrap(err)
 		}
-		warehouse.Packages[pos] = pack
 	}
+	return nil
+}
 
-	for {
-		words := strings.Split(scanner.Text(), " ")
+// inputLine a meaningful line of the input file, without its comment
+type inputLine struct {
+	number int
+	words  []inputWord
+}
+
+// inputWord a word of an input line and the column where it starts
+type inputWord struct {
+	text   string
+	column int
+}
 
-		if len(words) != 3 {
-			break
+// parseError an error located in the input file
+type parseError struct {
+	line    int
+	column  int
+	message string
+}
+
+func (err parseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", err.line, err.column, err.message)
+}
+
+// splitLine splits a line of the input file into words, a word starting with `--` starts a comment
+func splitLine(number int, text string) (line inputLine) {
+	line.number = number
+	start, startColumn, column := -1, 0, 0
+	addWord := func(end int) bool {
+		word := text[start:end]
+		if strings.HasPrefix(word, "--") {
+			return false
 		}
-		pj, pos, pjErr := parseForkLift(words)
-		if pjErr != nil {
-			err = pjErr
+		line.words = append(line.words, inputWord{text: word, column: startColumn})
+		start = -1
+		return true
+	}
+
+	for index, char := range text {
+		column++
+		if !unicode.IsSpace(char) {
+			if start < 0 {
+				start, startColumn = index, column
+			}
+		} else if start >= 0 && !addWord(index) {
 			return
 		}
-		if warehouse.SomethingExistsAt(pos) {
-			err = errors.New("two entities can't be at the same position")
-			return
+	}
+	if start >= 0 {
+		addWord(len(text))
+	}
+	return
+}
+
+// errorAt reports the word at index, or the missing words if the line is shorter, as not matching form
+func (line inputLine) errorAt(index int, form string) error {
+	if index < len(line.words) {
+		word := line.words[index]
+		return parseError{line.number, word.column, fmt.Sprintf("unexpected %q, expected %s", word.text, form)}
+	}
+	last := line.words[len(line.words)-1]
+	column := last.column + utf8.RuneCountInString(last.text)
+	return parseError{line.number, column, fmt.Sprintf("missing words, expected %s", form)}
+}
+
+// wrapAt locates err at the word at index, nil if err is nil
+func (line inputLine) wrapAt(index int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return parseError{line.number, line.words[index].column, err.Error()}
+}
+
+// wrap locates err at the start of the line, nil if err is nil
+func (line inputLine) wrap(err error) error {
+	return line.wrapAt(0, err)
+}
+
+// expectWords checks that the line has between min and max words, max being ignored when negative
+func (line inputLine) expectWords(form string, min int, max int) error {
+	if len(line.words) < min {
+		return line.errorAt(len(line.words), form)
+	}
+	if max >= 0 && len(line.words) > max {
+		return line.errorAt(max, form)
+	}
+	return nil
+}
+
+// numbers parses count numbers starting from the word at index from
+func (line inputLine) numbers(form string, from int, count int) ([]int, error) {
+	numbers := make([]int, count)
+
+	for index := range numbers {
+		number, err := strconv.Atoi(line.words[from+index].text)
+		if err != nil {
+			return nil, line.errorAt(from+index, form)
 		}
-		warehouse.ForkLifts[pos] = pj
-		if !scanner.Scan() {
-			return
+		numbers[index] = number
+	}
+	return numbers, nil
+}
+
+// inside checks that a Position read from the coordinates at index is inside the warehouse
+func (line inputLine) inside(index int, warehouse *Warehouse, pos Position) error {
+	return line.wrapAt(index, checkInside(warehouse, pos))
+}
+
+// packageList parses the packages formatted as name:color starting from the word at index from
+func (line inputLine) packageList(form string, from int) ([]Package, error) {
+	packages := make([]Package, 0, len(line.words)-from)
+
+	for index := from; index < len(line.words); index++ {
+		name, color, found := strings.Cut(line.words[index].text, ":")
+		weight, ok := colorToWeight[strings.ToLower(color)]
+		if !found || !ok {
+			return nil, line.errorAt(index, form)
 		}
+		packages = append(packages, Package{Name: name, Weight: weight})
+	}
+	return packages, nil
+}
+
+// parseScenarioFile parses a scenario written in the line format, in JSON or as a grid,
+// JSON is detected from the .json extension or from the content starting with an object,
+// a grid from its `grid` header
+func parseScenarioFile(file *os.File) (warehouse Warehouse, cycles uint, err error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return
+	}
+	if strings.EqualFold(filepath.Ext(file.Name()), ".json") || isJSONFile(content) {
+		return parseJSONFile(content)
 	}
+	if isGridFile(content) {
+		return parseGridFile(bytes.NewReader(content))
+	}
+	return parseInputFile(bytes.NewReader(content))
+}
 
-	for {
-		words := strings.Split(scanner.Text(), " ")
+func parseInputFile(file io.Reader) (warehouse Warehouse, cycles uint, err error) {
+	scanner := &inputScanner{Scanner: bufio.NewScanner(file), floors: 1}
 
-		if len(words) != 5 {
-			err = errors.New("invalid formatting for truck and loading place")
-			return
+	if !scanner.Scan() {
+		if err = scanner.Err(); err == nil {
+			err = parseError{scanner.number + 1, 1, "missing warehouse, expected " + warehouseForm}
 		}
-		truck, pos, truckErr := parseTruck(words)
-		if truckErr != nil {
-			err = truckErr
+		return
+	}
+	warehouse, cycles, err = parseWarehouse(scanner.line)
+	if err != nil {
+		return
+	}
+
+	for scanner.Scan() {
+		if err = parseLine(scanner, &warehouse); err != nil {
 			return
 		}
-		if warehouse.SomethingExistsAt(pos) {
-			err = errors.New("two entities can't be at the same position")
-			return
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	err = scanner.finish(&warehouse)
+	return
+}
+
+// parseLine parses a directive, a section header or an entity of the current section
+func parseLine(scanner *inputScanner, warehouse *Warehouse) error {
+	line := scanner.line
+	keyword := line.words[0].text
+
+	if scanner.floors > warehouse.Floors {
+		warehouse.Floors = scanner.floors
+	}
+	if parse, exists := directiveParsers[keyword]; exists {
+		return parse(line, scanner, warehouse)
+	}
+	if section, exists := sectionHeaders[keyword]; exists && len(line.words) == 1 {
+		scanner.section = section
+		scanner.explicit = true
+		return nil
+	}
+	if !scanner.explicit {
+		// Without headers, the sections follow each other and are told apart by their number of words
+		for scanner.section < trucksSection && len(line.words) != sectionParsers[scanner.section].words {
+			scanner.section++
 		}
-		warehouse.Trucks[pos] = truck
-		if !scanner.Scan() {
+	}
+	return sectionParsers[scanner.section].parse(line, scanner, warehouse)
+}
+
+const warehouseForm = "<length> <height> <cycles>"
+
+func parseWarehouse(line inputLine) (warehouse Warehouse, cycles uint, err error) {
+	if err = line.expectWords(warehouseForm, 3, 3); err != nil {
+		return
+	}
+	numbers, err := line.numbers(warehouseForm, 0, 3)
+	if err != nil {
+		return
+	}
+	for index, number := range numbers {
+		if number < 0 || (number == 0 && index < 2) {
+			err = line.errorAt(index, warehouseForm)
 			return
 		}
 	}
+	cycles = uint(numbers[2])
+	if err = line.wrapAt(2, checkCycles(cycles)); err != nil {
+		return
+	}
+	warehouse = newWarehouse(numbers[0], numbers[1])
+	return
 }
 
-func parseWarehouse(line string) (warehouse Warehouse, cycles uint, err error) {
+func checkCycles(cycles uint) error {
 	const minimumCycles = 10
 	const maximumCycles = 100_000
-	_, err = fmt.Sscanf(line, "%d %d %d", &warehouse.Length, &warehouse.Height, &cycles)
 
-	if err != nil {
-		return
-	}
 	if cycles < minimumCycles || cycles > maximumCycles {
-		err = errors.New("cycle should be between 10 and 100 000")
-		return
+		return errors.New("cycle should be between 10 and 100 000")
 	}
+	return nil
+}
+
+// newWarehouse creates an empty single floor Warehouse, ready to be filled by the parsers
+func newWarehouse(length int, height int) (warehouse Warehouse) {
+	warehouse.Length = length
+	warehouse.Height = height
 	warehouse.Packages = make(EntityMap[Package])
 	warehouse.ForkLifts = make(EntityMap[ForkLift])
 	warehouse.Trucks = make(EntityMap[Truck])
+	warehouse.Racks = make(EntityMap[Rack])
+	warehouse.Exits = make(map[Position]Exits)
+	warehouse.Costs = make(map[Position]int)
+	warehouse.Walls = make(map[Position]bool)
+	warehouse.Floors = 1
 	return
 }
 
-func parsePackage(words []string) (pack Package, position Position, err error) {
-	colorToWeight := map[string]Weight{
-		"yellow": 100,
-		"green":  200,
-		"blue":   500,
+var colorToWeight = map[string]Weight{
+	"yellow": 100,
+	"green":  200,
+	"blue":   500,
+}
+
+var nameToExit = map[string]Exits{
+	"up":         ExitUp,
+	"right":      ExitRight,
+	"down":       ExitDown,
+	"left":       ExitLeft,
+	"up-right":   ExitUpRight,
+	"down-right": ExitDownRight,
+	"down-left":  ExitDownLeft,
+	"up-left":    ExitUpLeft,
+	"none":       0,
+}
+
+var nameToNeighbourhood = map[string]Neighbourhood{
+	"4":   FourConnected,
+	"8":   EightConnected,
+	"hex": Hexagonal,
+}
+
+var nameToMission = map[string]Mission{
+	"outbound": Outbound,
+	"putaway":  PutAway,
+}
+
+var nameToSlotting = map[string]SlottingRule{
+	"nearest": NearestSlot,
+	"lowest":  LowestSlot,
+}
+
+// section the kind of entities described by the lines following a section header
+type section int
+
+const (
+	packagesSection section = iota
+	forkLiftsSection
+	trucksSection
+)
+
+var sectionHeaders = map[string]section{
+	"packages":  packagesSection,
+	"forklifts": forkLiftsSection,
+	"trucks":    trucksSection,
+}
+
+// sectionParsers the parser of the entities of every section, with the number of words describing them
+var sectionParsers = [...]struct {
+	words int
+	parse func(inputLine, *inputScanner, *Warehouse) error
+}{
+	packagesSection:  {4, parsePackage},
+	forkLiftsSection: {3, parseForkLift},
+	trucksSection:    {5, parseTruck},
+}
+
+const packageForm = "<name> <x> <y> <yellow|green|blue>"
+
+func parsePackage(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(packageForm, 4, 4); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(packageForm, 1, 2)
+	if err != nil {
+		return err
+	}
+	weight, ok := colorToWeight[strings.ToLower(line.words[3].text)]
+	if !ok {
+		return line.errorAt(3, packageForm)
 	}
-	pack.Name = words[0]
-	x, err1 := strconv.Atoi(words[1])
-	y, err2 := strconv.Atoi(words[2])
-	weight, ok := colorToWeight[strings.ToLower(words[3])]
+	pos := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(1, warehouse, pos); err != nil {
+		return err
+	}
+	if err = placeEntity(warehouse, pos); err != nil {
+		return line.wrap(err)
+	}
+	warehouse.Packages[pos] = Package{Name: line.words[0].text, Weight: weight}
+	return nil
+}
 
-	if err1 != nil || err2 != nil || !ok {
-		err = errors.New("invalid package formatting")
-		return
+const forkLiftForm = "<name> <x> <y>"
+
+func parseForkLift(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(forkLiftForm, 3, 3); err != nil {
+		return err
 	}
-	position.X = x
-	position.Y = y
-	pack.Weight = weight
-	return
+	numbers, err := line.numbers(forkLiftForm, 1, 2)
+	if err != nil {
+		return err
+	}
+	pos := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(1, warehouse, pos); err != nil {
+		return err
+	}
+	if err = placeEntity(warehouse, pos); err != nil {
+		return line.wrap(err)
+	}
+	warehouse.ForkLifts[pos] = ForkLift{Name: line.words[0].text}
+	return nil
 }
 
-func parseForkLift(words []string) (pj ForkLift, position Position, err error) {
-	pj.Name = words[0]
-	x, err1 := strconv.Atoi(words[1])
-	y, err2 := strconv.Atoi(words[2])
+const truckForm = "<name> <x> <y> <max weight> <cooldown>"
 
-	if err1 != nil || err2 != nil {
-		err = errors.New("invalid forklift formatting")
-		return
+func parseTruck(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(truckForm, 5, 5); err != nil {
+		return err
 	}
-	position.X = x
-	position.Y = y
-	return
+	numbers, err := line.numbers(truckForm, 1, 4)
+	if err != nil {
+		return err
+	}
+	pos := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(1, warehouse, pos); err != nil {
+		return err
+	}
+	if err = placeEntity(warehouse, pos); err != nil {
+		return line.wrap(err)
+	}
+	warehouse.Trucks[pos] = Truck{
+		Name:                  line.words[0].text,
+		MaxWeight:             Weight(numbers[2]),
+		ElapseDischargingTime: numbers[3],
+	}
+	return nil
 }
 
-func parseTruck(words []string) (truck Truck, position Position, err error) {
-	truck.Name = words[0]
-	x, err1 := strconv.Atoi(words[1])
-	y, err2 := strconv.Atoi(words[2])
-	maxWeight, err3 := strconv.Atoi(words[3])
-	elapseDischargingTime, err4 := strconv.Atoi(words[4])
-	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
-		err = errors.New("invalid truck formatting")
-		return
+// checkInside checks that a Position is on a tile and a floor of the warehouse
+func checkInside(warehouse *Warehouse, pos Position) error {
+	if pos.X < 0 || pos.X >= warehouse.Length || pos.Y < 0 || pos.Y >= warehouse.Height {
+		return fmt.Errorf("position [%d,%d] is outside the warehouse", pos.X, pos.Y)
 	}
-	truck.ElapseDischargingTime = elapseDischargingTime
-	truck.MaxWeight = Weight(maxWeight)
-	truck.CurrentWeight = Weight(0)
-	position.X = x
-	position.Y = y
-	return
+	if pos.Floor < 0 || pos.Floor >= warehouse.FloorCount() {
+		return fmt.Errorf("floor %d is outside the warehouse", pos.Floor)
+	}
+	return nil
+}
+
+// placeEntity checks that an entity can be placed at a position
+func placeEntity(warehouse *Warehouse, pos Position) error {
+	if err := checkInside(warehouse, pos); err != nil {
+		return err
+	}
+	if warehouse.SomethingExistsAt(pos) {
+		return errors.New("two entities can't be at the same position")
+	}
+	return nil
+}
+
+var directiveParsers = map[string]func(inputLine, *inputScanner, *Warehouse) error{
+	"level":         parseLevel,
+	"wall":          parseWall,
+	"lane":          parseLane,
+	"exits":         parseExits,
+	"costs":         parseCosts,
+	"neighbourhood": parseNeighbourhood,
+	"lift":          parseLift,
+	"rack":          parseRack,
+	"mission":       parseMission,
+	"cargo":         parseCargo,
+	"order":         parseOrder,
+	"carry":         parseCarry,
+	"load":          parseLoad,
+	"progress":      parseProgress,
+}
+
+const levelForm = "level <floor>"
+
+func parseLevel(line inputLine, scanner *inputScanner, _ *Warehouse) error {
+	if err := line.expectWords(levelForm, 2, 2); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(levelForm, 1, 1)
+	if err != nil {
+		return err
+	}
+	if numbers[0] < 0 {
+		return line.errorAt(1, levelForm)
+	}
+	scanner.level = numbers[0]
+	if scanner.level >= scanner.floors {
+		scanner.floors = scanner.level + 1
+	}
+	return nil
+}
+
+const wallForm = "wall <x> <y>"
+
+func parseWall(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(wallForm, 3, 3); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(wallForm, 1, 2)
+	if err != nil {
+		return err
+	}
+	pos := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(1, warehouse, pos); err != nil {
+		return err
+	}
+	return line.wrap(addWall(warehouse, pos))
+}
+
+func addWall(warehouse *Warehouse, pos Position) error {
+	if err := placeEntity(warehouse, pos); err != nil {
+		return err
+	}
+	warehouse.Walls[pos] = true
+	return nil
+}
+
+const laneForm = "lane <name> <x1> <y1> <x2> <y2>"
+
+func parseLane(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(laneForm, 6, 6); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(laneForm, 2, 4)
+	if err != nil {
+		return err
+	}
+	from := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	to := Position{X: numbers[2], Y: numbers[3], Floor: scanner.level}
+	if err = warehouse.AddLane(from, to); err != nil {
+		return line.wrap(fmt.Errorf("lane %s: %w", line.words[1].text, err))
+	}
+	return nil
+}
+
+const exitsForm = "exits <x> <y> <direction>[,<direction>...]"
+
+func parseExits(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(exitsForm, 4, 4); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(exitsForm, 1, 2)
+	if err != nil {
+		return err
+	}
+	exits, err := parseExitNames(strings.Split(line.words[3].text, ","))
+	if err != nil {
+		return line.errorAt(3, exitsForm)
+	}
+	pos := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(1, warehouse, pos); err != nil {
+		return err
+	}
+	warehouse.Exits[pos] = exits
+	return nil
+}
+
+func parseExitNames(names []string) (Exits, error) {
+	var exits Exits
+
+	for _, name := range names {
+		exit, ok := nameToExit[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown direction %s", name)
+		}
+		exits |= exit
+	}
+	return exits, nil
+}
+
+func parseCosts(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords("costs", 1, 1); err != nil {
+		return err
+	}
+	rowForm := fmt.Sprintf("a row of %d positive tile costs", warehouse.Length)
+
+	for y := 0; y < warehouse.Height; y++ {
+		if !scanner.Scan() {
+			return line.wrap(errors.New("costs grid should have a line for every row of the warehouse"))
+		}
+		row := scanner.line
+		if err := row.expectWords(rowForm, warehouse.Length, warehouse.Length); err != nil {
+			return err
+		}
+		costs, err := row.numbers(rowForm, 0, warehouse.Length)
+		if err != nil {
+			return err
+		}
+		for x, cost := range costs {
+			if cost < 1 {
+				return row.errorAt(x, rowForm)
+			}
+		}
+		if err = addCostsRow(warehouse, Position{Y: y, Floor: scanner.level}, costs); err != nil {
+			return row.wrap(err)
+		}
+	}
+	return nil
+}
+
+// addCostsRow sets the costs of the tiles of a row, given by the Position of its first tile
+func addCostsRow(warehouse *Warehouse, start Position, row []int) error {
+	if len(row) != warehouse.Length {
+		return errors.New("costs grid should have a cost for every column of the warehouse")
+	}
+
+	for x, cost := range row {
+		if cost < 1 {
+			return errors.New("tile costs should be positive numbers")
+		}
+		if cost != 1 {
+			warehouse.Costs[Position{X: x, Y: start.Y, Floor: start.Floor}] = cost
+		}
+	}
+	return nil
+}
+
+const neighbourhoodForm = "neighbourhood <4|8|hex>"
+
+func parseNeighbourhood(line inputLine, _ *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(neighbourhoodForm, 2, 2); err != nil {
+		return err
+	}
+	neighbourhood, ok := nameToNeighbourhood[strings.ToLower(line.words[1].text)]
+	if !ok {
+		return line.errorAt(1, neighbourhoodForm)
+	}
+	warehouse.Neighbourhood = neighbourhood
+	return nil
+}
+
+const liftForm = "lift <name> <x> <y> <lowest floor> <highest floor> <transfer time> <capacity>"
+
+func parseLift(line inputLine, _ *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(liftForm, 8, 8); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(liftForm, 2, 6)
+	if err != nil {
+		return err
+	}
+	if err = line.inside(2, warehouse, Position{X: numbers[0], Y: numbers[1]}); err != nil {
+		return err
+	}
+
+	return line.wrap(addLift(warehouse, Lift{
+		Name:         line.words[1].text,
+		X:            numbers[0],
+		Y:            numbers[1],
+		LowestFloor:  numbers[2],
+		HighestFloor: numbers[3],
+		TransferTime: numbers[4],
+		Capacity:     numbers[5],
+	}))
+}
+
+func addLift(warehouse *Warehouse, lift Lift) error {
+	if lift.LowestFloor < 0 || lift.LowestFloor >= lift.HighestFloor {
+		return errors.New("a lift should go from a floor to a higher one")
+	}
+	if lift.TransferTime < 1 || lift.Capacity < 1 {
+		return errors.New("lift transfer time and capacity should be positive numbers")
+	}
+	if err := checkInside(warehouse, Position{X: lift.X, Y: lift.Y}); err != nil {
+		return err
+	}
+	if lift.HighestFloor >= warehouse.Floors {
+		warehouse.Floors = lift.HighestFloor + 1
+	}
+	warehouse.Lifts = append(warehouse.Lifts, lift)
+	return nil
+}
+
+const rackForm = "rack <name> <x> <y> <slots> <retrieval time> [<package>:<yellow|green|blue>...]"
+
+func parseRack(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(rackForm, 6, -1); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(rackForm, 2, 4)
+	if err != nil {
+		return err
+	}
+	stack, err := line.packageList(rackForm, 6)
+	if err != nil {
+		return err
+	}
+
+	pos := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(2, warehouse, pos); err != nil {
+		return err
+	}
+	return line.wrap(addRack(warehouse, pos, Rack{
+		Name:          line.words[1].text,
+		Slots:         numbers[2],
+		RetrievalTime: numbers[3],
+		Stack:         stack,
+	}))
+}
+
+func addRack(warehouse *Warehouse, pos Position, rack Rack) error {
+	if rack.Slots < 1 || rack.RetrievalTime < 1 {
+		return errors.New("rack slots and retrieval time should be positive numbers")
+	}
+	if len(rack.Stack) > rack.Slots {
+		return errors.New("a rack can't hold more packages than its slots")
+	}
+	if err := placeEntity(warehouse, pos); err != nil {
+		return err
+	}
+	warehouse.Racks[pos] = rack
+	return nil
+}
+
+const missionForm = "mission <outbound|putaway> [nearest|lowest]"
+
+func parseMission(line inputLine, _ *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(missionForm, 2, 3); err != nil {
+		return err
+	}
+	mission, ok := nameToMission[strings.ToLower(line.words[1].text)]
+	if !ok {
+		return line.errorAt(1, missionForm)
+	}
+	warehouse.Mission = mission
+
+	if len(line.words) == 3 {
+		slotting, ok := nameToSlotting[strings.ToLower(line.words[2].text)]
+		if !ok {
+			return line.errorAt(2, missionForm)
+		}
+		warehouse.Slotting = slotting
+	}
+	return nil
+}
+
+const cargoForm = "cargo <truck> <package>:<yellow|green|blue>..."
+
+func parseCargo(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(cargoForm, 3, -1); err != nil {
+		return err
+	}
+	cargo, err := line.packageList(cargoForm, 2)
+	if err != nil {
+		return err
+	}
+
+	// The truck can be described further in the file
+	scanner.deferred = append(scanner.deferred, func() error {
+		return line.wrap(addCargo(warehouse, line.words[1].text, cargo))
+	})
+	return nil
+}
+
+func addCargo(warehouse *Warehouse, truckName string, cargo []Package) error {
+	for pos, truck := range warehouse.Trucks {
+		if truck.Name != truckName {
+			continue
+		}
+		for _, pack := range cargo {
+			truck.CurrentWeight += pack.Weight
+		}
+		if truck.CurrentWeight > truck.MaxWeight {
+			return fmt.Errorf("cargo of %s: too heavy for the truck", truck.Name)
+		}
+		truck.Cargo = append(truck.Cargo, cargo...)
+		warehouse.Trucks[pos] = truck
+		return nil
+	}
+	return fmt.Errorf("cargo of %s: no such truck", truckName)
+}
+
+const orderForm = "order <name> <x> <y> <truck> <package>..."
+
+func parseOrder(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(orderForm, 6, -1); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(orderForm, 2, 2)
+	if err != nil {
+		return err
+	}
+	staging := Position{X: numbers[0], Y: numbers[1], Floor: scanner.level}
+	if err = line.inside(2, warehouse, staging); err != nil {
+		return err
+	}
+	packages := make([]string, 0, len(line.words)-5)
+	for _, word := range line.words[5:] {
+		packages = append(packages, word.text)
+	}
+
+	err = addOrder(warehouse, Order{
+		Name:     line.words[1].text,
+		Staging:  staging,
+		Truck:    line.words[4].text,
+		Packages: packages,
+	})
+	if err != nil {
+		return line.wrap(err)
+	}
+
+	// The truck and the packages of the order can be described further in the file
+	scanner.orders = append(scanner.orders, line)
+	return nil
+}
+
+func addOrder(warehouse *Warehouse, order Order) error {
+	if err := placeEntity(warehouse, order.Staging); err != nil {
+		return err
+	}
+	warehouse.Orders = append(warehouse.Orders, order)
+	return nil
+}
+
+// resolveOrders marks the packages of every order once every one of them is known
+func resolveOrders(warehouse *Warehouse) error {
+	for index := range warehouse.Orders {
+		if err := resolveOrder(warehouse, &warehouse.Orders[index]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveOrder finds the packages of an Order, a package of an Order partially loaded missing from the Warehouse
+// being already in its Truck
+func resolveOrder(warehouse *Warehouse, order *Order) error {
+	truckPos, exists := warehouse.TruckPosition(order.Truck)
+	if !exists {
+		return fmt.Errorf("order %s: no such truck %s", order.Name, order.Truck)
+	}
+
+	order.Weight = order.Loaded
+	for _, name := range order.Packages {
+		if weight, staged := stagedWeight(*order, name); staged {
+			order.Weight += weight
+			continue
+		}
+		weight, found := markOrderPackage(warehouse, name, order.Name)
+		if !found && order.Loaded == 0 {
+			return fmt.Errorf("order %s: no such package %s, or it already belongs to an order", order.Name, name)
+		}
+		order.Weight += weight
+	}
+	if order.Weight > warehouse.Trucks[truckPos].MaxWeight {
+		return fmt.Errorf("order %s: too heavy for the truck %s", order.Name, order.Truck)
+	}
+	return nil
+}
+
+func markOrderPackage(warehouse *Warehouse, name string, orderName string) (Weight, bool) {
+	for pos, pack := range warehouse.Packages {
+		if pack.Name == name && pack.Order == "" {
+			pack.Order = orderName
+			warehouse.Packages[pos] = pack
+			return pack.Weight, true
+		}
+	}
+	for _, rack := range warehouse.Racks {
+		for level, pack := range rack.Stack {
+			if pack.Name == name && pack.Order == "" {
+				rack.Stack[level].Order = orderName
+				return pack.Weight, true
+			}
+		}
+	}
+	for pos, forklift := range warehouse.ForkLifts {
+		if pack, carrying := forklift.Carrying(); carrying && pack.Name == name && pack.Order == "" {
+			pack.Order = orderName
+			warehouse.ForkLifts[pos] = forklift.Carry(pack)
+			return pack.Weight, true
+		}
+	}
+	return 0, false
+}
+
+func stagedWeight(order Order, name string) (Weight, bool) {
+	for _, pack := range order.Staged {
+		if pack.Name == name {
+			return pack.Weight, true
+		}
+	}
+	return 0, false
+}
+
+const carryForm = "carry <forklift> <package>:<yellow|green|blue>"
+
+func parseCarry(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(carryForm, 3, 3); err != nil {
+		return err
+	}
+	packages, err := line.packageList(carryForm, 2)
+	if err != nil {
+		return err
+	}
+
+	// The forklift can be described further in the file
+	scanner.deferred = append(scanner.deferred, func() error {
+		return line.wrap(addCarried(warehouse, line.words[1].text, packages[0]))
+	})
+	return nil
+}
+
+// addCarried gives a Package to a ForkLift, when restoring a running Warehouse
+func addCarried(warehouse *Warehouse, forkliftName string, pack Package) error {
+	for pos, forklift := range warehouse.ForkLifts {
+		if forklift.Name != forkliftName {
+			continue
+		}
+		if _, carrying := forklift.Carrying(); carrying {
+			return fmt.Errorf("forklift %s: already carrying a package", forkliftName)
+		}
+		warehouse.ForkLifts[pos] = forklift.Carry(pack)
+		return nil
+	}
+	return fmt.Errorf("no such forklift %s", forkliftName)
+}
+
+const loadForm = "load <truck> <current weight> <cycles until return>"
+
+func parseLoad(line inputLine, scanner *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(loadForm, 4, 4); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(loadForm, 2, 2)
+	if err != nil {
+		return err
+	}
+	for index, number := range numbers {
+		if number < 0 {
+			return line.errorAt(index+2, loadForm)
+		}
+	}
+
+	// The truck and its cargo can be described further in the file
+	scanner.deferred = append(scanner.deferred, func() error {
+		return line.wrap(setTruckLoad(warehouse, line.words[1].text, Weight(numbers[0]), numbers[1]))
+	})
+	return nil
+}
+
+// setTruckLoad sets the Weight loaded in a Truck and the cycles until it's back, when restoring a running Warehouse
+func setTruckLoad(warehouse *Warehouse, truckName string, weight Weight, timeUntilReturn int) error {
+	pos, exists := warehouse.TruckPosition(truckName)
+	if !exists {
+		return fmt.Errorf("no such truck %s", truckName)
+	}
+	truck := warehouse.Trucks[pos]
+	if weight > truck.MaxWeight {
+		return fmt.Errorf("truck %s: too heavy for the truck", truckName)
+	}
+	truck.CurrentWeight = weight
+	truck.TimeUntilReturn = timeUntilReturn
+	warehouse.Trucks[pos] = truck
+	return nil
+}
+
+const progressForm = "progress <order> <loaded weight> <gathering|consolidated> [<package>:<yellow|green|blue>...]"
+
+var nameToConsolidated = map[string]bool{
+	"gathering":    false,
+	"consolidated": true,
+}
+
+func parseProgress(line inputLine, _ *inputScanner, warehouse *Warehouse) error {
+	if err := line.expectWords(progressForm, 4, -1); err != nil {
+		return err
+	}
+	numbers, err := line.numbers(progressForm, 2, 1)
+	if err != nil {
+		return err
+	}
+	if numbers[0] < 0 {
+		return line.errorAt(2, progressForm)
+	}
+	consolidated, ok := nameToConsolidated[strings.ToLower(line.words[3].text)]
+	if !ok {
+		return line.errorAt(3, progressForm)
+	}
+	staged, err := line.packageList(progressForm, 4)
+	if err != nil {
+		return err
+	}
+
+	return line.wrap(setOrderProgress(warehouse, line.words[1].text, Weight(numbers[0]), consolidated, staged))
+}
+
+// setOrderProgress sets what was done of an Order, when restoring a running Warehouse, the Order has to be resolved
+// afterwards
+func setOrderProgress(warehouse *Warehouse, orderName string, loaded Weight, consolidated bool, staged []Package,
+) error {
+	for index := range warehouse.Orders {
+		order := &warehouse.Orders[index]
+		if order.Name != orderName {
+			continue
+		}
+		order.Loaded = loaded
+		order.Consolidated = consolidated
+		order.Staged = make([]Package, len(staged))
+		for level, pack := range staged {
+			pack.Order = order.Name
+			order.Staged[level] = pack
+		}
+		return nil
+	}
+	return fmt.Errorf("no such order %s, it should be described before its progress", orderName)
 }
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// jsonScenario the structured description of a warehouse, every section but the warehouse size and cycles is optional
+type jsonScenario struct {
+	Length        int            `json:"length"`
+	Height        int            `json:"height"`
+	Cycles        uint           `json:"cycles"`
+	Floors        int            `json:"floors,omitempty"`
+	Neighbourhood string         `json:"neighbourhood,omitempty"`
+	Mission       string         `json:"mission,omitempty"`
+	Slotting      string         `json:"slotting,omitempty"`
+	Packages      []jsonPackage  `json:"packages,omitempty"`
+	ForkLifts     []jsonForkLift `json:"forklifts,omitempty"`
+	Trucks        []jsonTruck    `json:"trucks,omitempty"`
+	Walls         []jsonPosition `json:"walls,omitempty"`
+	Lanes         []jsonLane     `json:"lanes,omitempty"`
+	Exits         []jsonExits    `json:"exits,omitempty"`
+	Costs         []jsonCosts    `json:"costs,omitempty"`
+	Lifts         []jsonLift     `json:"lifts,omitempty"`
+	Racks         []jsonRack     `json:"racks,omitempty"`
+	Orders        []jsonOrder    `json:"orders,omitempty"`
+}
+
+type jsonPosition struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Floor int `json:"floor,omitempty"`
+}
+
+// jsonItem a package that is not lying on the floor
+type jsonItem struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type jsonPackage struct {
+	jsonItem
+	jsonPosition
+}
+
+type jsonForkLift struct {
+	Name string `json:"name"`
+	jsonPosition
+	Carrying *jsonItem `json:"carrying,omitempty"`
+}
+
+type jsonTruck struct {
+	Name string `json:"name"`
+	jsonPosition
+	MaxWeight       int        `json:"max_weight"`
+	Cooldown        int        `json:"cooldown"`
+	Cargo           []jsonItem `json:"cargo,omitempty"`
+	CurrentWeight   *int       `json:"current_weight,omitempty"`
+	TimeUntilReturn int        `json:"time_until_return,omitempty"`
+}
+
+type jsonLane struct {
+	Name string       `json:"name"`
+	From jsonPosition `json:"from"`
+	To   jsonPosition `json:"to"`
+}
+
+type jsonExits struct {
+	jsonPosition
+	Directions []string `json:"directions"`
+}
+
+type jsonCosts struct {
+	Floor int     `json:"floor,omitempty"`
+	Grid  [][]int `json:"grid"`
+}
+
+type jsonLift struct {
+	Name         string `json:"name"`
+	X            int    `json:"x"`
+	Y            int    `json:"y"`
+	LowestFloor  int    `json:"lowest_floor"`
+	HighestFloor int    `json:"highest_floor"`
+	TransferTime int    `json:"transfer_time"`
+	Capacity     int    `json:"capacity"`
+}
+
+type jsonRack struct {
+	Name string `json:"name"`
+	jsonPosition
+	Slots         int        `json:"slots"`
+	RetrievalTime int        `json:"retrieval_time"`
+	Packages      []jsonItem `json:"packages,omitempty"`
+}
+
+type jsonOrder struct {
+	Name         string       `json:"name"`
+	Staging      jsonPosition `json:"staging"`
+	Truck        string       `json:"truck"`
+	Packages     []string     `json:"packages"`
+	Loaded       int          `json:"loaded,omitempty"`
+	Consolidated bool         `json:"consolidated,omitempty"`
+	Staged       []jsonItem   `json:"staged,omitempty"`
+}
+
+// isJSONFile checks if the content of an input file is a JSON object
+func isJSONFile(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), []byte("{"))
+}
+
+func parseJSONFile(content []byte) (warehouse Warehouse, cycles uint, err error) {
+	var scenario jsonScenario
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	if err = decoder.Decode(&scenario); err != nil {
+		err = fmt.Errorf("invalid JSON scenario: %w", err)
+		return
+	}
+	return scenario.warehouse()
+}
+
+// warehouse builds the Warehouse described by the scenario
+func (scenario jsonScenario) warehouse() (warehouse Warehouse, cycles uint, err error) {
+	if err = checkCycles(scenario.Cycles); err != nil {
+		return
+	}
+	if scenario.Length < 1 || scenario.Height < 1 {
+		err = errors.New("warehouse length and height should be positive numbers")
+		return
+	}
+	warehouse = newWarehouse(scenario.Length, scenario.Height)
+	cycles = scenario.Cycles
+
+	if err = scenario.setModes(&warehouse); err != nil {
+		return
+	}
+	if err = scenario.addLayout(&warehouse); err != nil {
+		return
+	}
+	if err = scenario.addEntities(&warehouse); err != nil {
+		return
+	}
+	err = resolveOrders(&warehouse)
+	return
+}
+
+func (scenario jsonScenario) setModes(warehouse *Warehouse) error {
+	var ok bool
+
+	if scenario.Neighbourhood != "" {
+		if warehouse.Neighbourhood, ok = nameToNeighbourhood[strings.ToLower(scenario.Neighbourhood)]; !ok {
+			return errors.New("neighbourhood should be 4, 8 or hex")
+		}
+	}
+	if scenario.Mission != "" {
+		if warehouse.Mission, ok = nameToMission[strings.ToLower(scenario.Mission)]; !ok {
+			return errors.New("mission should be outbound or putaway")
+		}
+	}
+	if scenario.Slotting != "" {
+		if warehouse.Slotting, ok = nameToSlotting[strings.ToLower(scenario.Slotting)]; !ok {
+			return errors.New("slotting rule should be nearest or lowest")
+		}
+	}
+	return nil
+}
+
+// addLayout adds the floors and tiles of the warehouse, the entities can then be placed on every floor
+func (scenario jsonScenario) addLayout(warehouse *Warehouse) error {
+	if scenario.Floors < 0 {
+		return errors.New("floors should be a positive number")
+	}
+	warehouse.Floors = scenario.floors()
+
+	for index, lift := range scenario.Lifts {
+		if err := checkInside(warehouse, Position{X: lift.X, Y: lift.Y, Floor: lift.HighestFloor}); err != nil {
+			return fmt.Errorf("lifts[%d]: %w", index, err)
+		}
+		err := addLift(warehouse, Lift{
+			Name: lift.Name, X: lift.X, Y: lift.Y,
+			LowestFloor: lift.LowestFloor, HighestFloor: lift.HighestFloor,
+			TransferTime: lift.TransferTime, Capacity: lift.Capacity,
+		})
+		if err != nil {
+			return fmt.Errorf("lifts[%d]: %w", index, err)
+		}
+	}
+	for index, wall := range scenario.Walls {
+		if err := addWall(warehouse, wall.position()); err != nil {
+			return fmt.Errorf("walls[%d]: %w", index, err)
+		}
+	}
+	for index, lane := range scenario.Lanes {
+		if err := warehouse.AddLane(lane.From.position(), lane.To.position()); err != nil {
+			return fmt.Errorf("lanes[%d]: lane %s: %w", index, lane.Name, err)
+		}
+	}
+	for index, exits := range scenario.Exits {
+		allowed, err := parseExitNames(exits.Directions)
+		if err == nil {
+			err = checkInside(warehouse, exits.position())
+		}
+		if err != nil {
+			return fmt.Errorf("exits[%d]: %w", index, err)
+		}
+		warehouse.Exits[exits.position()] = allowed
+	}
+	for index, costs := range scenario.Costs {
+		if err := checkInside(warehouse, Position{Floor: costs.Floor}); err != nil {
+			return fmt.Errorf("costs[%d]: %w", index, err)
+		}
+		if len(costs.Grid) != warehouse.Height {
+			return fmt.Errorf("costs[%d]: costs grid should have a line for every row of the warehouse", index)
+		}
+		for y, row := range costs.Grid {
+			if err := addCostsRow(warehouse, Position{Y: y, Floor: costs.Floor}, row); err != nil {
+				return fmt.Errorf("costs[%d]: %w", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (scenario jsonScenario) addEntities(warehouse *Warehouse) error {
+	for index, pack := range scenario.Packages {
+		weight, err := pack.weight()
+		if err == nil {
+			err = placeEntity(warehouse, pack.position())
+		}
+		if err != nil {
+			return fmt.Errorf("packages[%d]: %w", index, err)
+		}
+		warehouse.Packages[pack.position()] = Package{Name: pack.Name, Weight: weight}
+	}
+	for index, forklift := range scenario.ForkLifts {
+		if err := placeEntity(warehouse, forklift.position()); err != nil {
+			return fmt.Errorf("forklifts[%d]: %w", index, err)
+		}
+		warehouse.ForkLifts[forklift.position()] = ForkLift{Name: forklift.Name}
+		if forklift.Carrying == nil {
+			continue
+		}
+		weight, err := forklift.Carrying.weight()
+		if err != nil {
+			return fmt.Errorf("forklifts[%d]: %w", index, err)
+		}
+		warehouse.ForkLifts[forklift.position()] = ForkLift{Name: forklift.Name}.Carry(
+			Package{Name: forklift.Carrying.Name, Weight: weight})
+	}
+	for index, truck := range scenario.Trucks {
+		if err := placeEntity(warehouse, truck.position()); err != nil {
+			return fmt.Errorf("trucks[%d]: %w", index, err)
+		}
+		warehouse.Trucks[truck.position()] = Truck{
+			Name: truck.Name, MaxWeight: Weight(truck.MaxWeight), ElapseDischargingTime: truck.Cooldown,
+		}
+		if err := truck.addState(warehouse); err != nil {
+			return fmt.Errorf("trucks[%d]: %w", index, err)
+		}
+	}
+	for index, rack := range scenario.Racks {
+		stack, err := jsonItems(rack.Packages)
+		if err == nil {
+			err = addRack(warehouse, rack.position(), Rack{
+				Name: rack.Name, Slots: rack.Slots, RetrievalTime: rack.RetrievalTime, Stack: stack,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("racks[%d]: %w", index, err)
+		}
+	}
+	for index, order := range scenario.Orders {
+		err := addOrder(warehouse, Order{
+			Name: order.Name, Staging: order.Staging.position(), Truck: order.Truck, Packages: order.Packages,
+		})
+		if err != nil {
+			return fmt.Errorf("orders[%d]: %w", index, err)
+		}
+		staged, err := jsonItems(order.Staged)
+		if err == nil {
+			err = setOrderProgress(warehouse, order.Name, Weight(order.Loaded), order.Consolidated, staged)
+		}
+		if err != nil {
+			return fmt.Errorf("orders[%d]: %w", index, err)
+		}
+	}
+	return nil
+}
+
+// addState adds the cargo of a Truck and, when restoring a running Warehouse, its loading state
+func (truck jsonTruck) addState(warehouse *Warehouse) error {
+	if len(truck.Cargo) != 0 {
+		cargo, err := jsonItems(truck.Cargo)
+		if err == nil {
+			err = addCargo(warehouse, truck.Name, cargo)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if truck.CurrentWeight == nil && truck.TimeUntilReturn == 0 {
+		return nil
+	}
+
+	current := warehouse.Trucks[truck.position()].CurrentWeight
+	if truck.CurrentWeight != nil {
+		current = Weight(*truck.CurrentWeight)
+	}
+	return setTruckLoad(warehouse, truck.Name, current, truck.TimeUntilReturn)
+}
+
+// floors returns the number of floors of the scenario, the floors used by its positions when it doesn't give them
+func (scenario jsonScenario) floors() int {
+	if scenario.Floors > 0 {
+		return scenario.Floors
+	}
+	floors := 1
+	use := func(floor int) {
+		if floor >= floors {
+			floors = floor + 1
+		}
+	}
+
+	for _, pack := range scenario.Packages {
+		use(pack.Floor)
+	}
+	for _, forklift := range scenario.ForkLifts {
+		use(forklift.Floor)
+	}
+	for _, truck := range scenario.Trucks {
+		use(truck.Floor)
+	}
+	for _, rack := range scenario.Racks {
+		use(rack.Floor)
+	}
+	for _, lift := range scenario.Lifts {
+		use(lift.HighestFloor)
+	}
+	for _, order := range scenario.Orders {
+		use(order.Staging.Floor)
+	}
+	for _, costs := range scenario.Costs {
+		use(costs.Floor)
+	}
+	for _, wall := range scenario.Walls {
+		use(wall.Floor)
+	}
+	return floors
+}
+
+func (pos jsonPosition) position() Position {
+	return Position{X: pos.X, Y: pos.Y, Floor: pos.Floor}
+}
+
+func (item jsonItem) weight() (Weight, error) {
+	weight, ok := colorToWeight[strings.ToLower(item.Color)]
+	if !ok {
+		return 0, fmt.Errorf("package %s: color should be yellow, green or blue", item.Name)
+	}
+	return weight, nil
+}
+
+func jsonItems(items []jsonItem) ([]Package, error) {
+	packages := make([]Package, 0, len(items))
+
+	for _, item := range items {
+		weight, err := item.weight()
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, Package{Name: item.Name, Weight: weight})
+	}
+	return packages, nil
+}
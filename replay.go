@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// replay runs the replay subcommand, printing the cycles of an event log applied to its initial scenario
+func replay(arguments []string) error {
+	var from, to uint
+	var themeName string
+	var legend, interactive bool
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.UintVar(&from, "from", 1, "first cycle printed")
+	flags.UintVar(&to, "to", 0, "last cycle printed, the last one of the log when 0")
+	flags.StringVar(&themeName, "theme", "emoji", "how the warehouse is drawn, emoji, ascii or ansi")
+	flags.BoolVar(&legend, "legend", false, "list the name, the position and the state of every entity under the map")
+	flags.BoolVar(&interactive, "i", false, "scrub through the replay in the full-screen terminal UI, from the cycle before -from")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gotrans replay [options] <scenario> <events>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); errors.Is(err, flag.ErrHelp) {
+		// The usage asked for is printed by the flags
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("replay expects a scenario and an event log")
+	}
+	theme, exists := nameToTheme[strings.ToLower(themeName)]
+	if !exists {
+		return fmt.Errorf("unknown theme %q, expected emoji, ascii or ansi", themeName)
+	}
+
+	scenario, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(scenario)
+	warehouse, cycles, err := parseScenarioFile(scenario)
+	if err != nil {
+		return err
+	}
+
+	events, err := os.Open(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(events)
+
+	if interactive {
+		return replayInteractive(warehouse, cycles, events, from, to, theme)
+	}
+	replayed := NewReplay(warehouse)
+	err = replayEventLog(events, replayed, func(state CycleState) {
+		if replayed.Cycle >= from && (to == 0 || replayed.Cycle <= to) {
+			fmt.Printf("tour %d/%d\n", replayed.Cycle, cycles)
+			fmt.Println(options{theme: theme, legend: legend}.show(state))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replayed %d cycles, the event log is consistent\n", replayed.Cycle)
+	return nil
+}
+
+// replayInteractive replays a whole event log up to the cycle to, then shows it in the terminal UI, to step back
+// and forth through its cycles
+func replayInteractive(warehouse Warehouse, cycles uint, events io.Reader, from uint, to uint, theme theme) error {
+	initial := warehouse.Clone()
+	replayed := NewReplay(warehouse)
+	var states []CycleState
+	err := replayEventLog(events, replayed, func(state CycleState) {
+		if to == 0 || replayed.Cycle <= to {
+			states = append(states, state)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	start := uint(0)
+	if from > 0 {
+		start = from - 1
+	}
+	return runTUI(initial, cycles, start, theme, func() (CycleState, []string, bool) {
+		if len(states) == 0 {
+			return CycleState{}, nil, false
+		}
+		state := states[0]
+		states = states[1:]
+		return state, nil, true
+	})
+}
+
+// replayEventLog applies the event log to a Replay cycle by cycle, as it's read, a cycle without any Event being
+// replayed as well
+func replayEventLog(file io.Reader, replay *Replay, show func(CycleState)) error {
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	var events []Event
+	cycle := uint(1)
+
+	step := func() error {
+		state, err := replay.Step(events)
+		if err != nil {
+			return err
+		}
+		show(state)
+		events = nil
+		return nil
+	}
+
+	for {
+		var jsonEvent jsonEvent
+		if err := decoder.Decode(&jsonEvent); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid event log: %w", err)
+		}
+		if jsonEvent.Cycle < cycle {
+			return fmt.Errorf("invalid event log: cycle %d comes after cycle %d", jsonEvent.Cycle, cycle)
+		}
+		for ; cycle < jsonEvent.Cycle; cycle++ {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+
+		event, err := jsonEvent.event()
+		if err != nil {
+			return fmt.Errorf("invalid event log: cycle %d: %w", jsonEvent.Cycle, err)
+		}
+		events = append(events, event)
+	}
+	if events == nil {
+		return nil
+	}
+	return step()
+}
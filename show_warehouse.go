@@ -3,33 +3,59 @@ package main
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/Harmos274/gotrans/warehouse"
 )
 
 type showableWarehouse warehouse.CycleState
 
-func (sw showableWarehouse) warehouseMap() string {
+func (sw showableWarehouse) warehouseMap(theme theme) string {
+	return sw.highlightedMap(theme, nil)
+}
+
+// highlightedMap draws the warehouse in a theme, the highlighted tiles on a yellow background
+func (sw showableWarehouse) highlightedMap(theme theme, highlighted map[warehouse.Position]bool) string {
+	labels := newTileLabels(sw.Warehouse)
+	if sw.Warehouse.FloorCount() == 1 {
+		return sw.floorMap(0, theme, labels, highlighted)
+	}
+
+	var w string
+	for floor := 0; floor < sw.Warehouse.FloorCount(); floor++ {
+		w += fmt.Sprintf("level %d\n", floor) + sw.floorMap(floor, theme, labels, highlighted)
+	}
+	return w
+}
+
+func (sw showableWarehouse) floorMap(floor int, theme theme, labels tileLabels,
+	highlighted map[warehouse.Position]bool,
+) string {
 	wr := sw.Warehouse
-	w := strings.Repeat("#", wr.Length*2+2)
+	hexagonal := wr.Neighbourhood == warehouse.Hexagonal
+	width := wr.Length * 2
+	if hexagonal {
+		width++
+	}
+
+	w := strings.Repeat("#", width+2)
 	for y := 0; y < wr.Height; y++ {
-		w += "#\n# "
+		w += "#\n# " + strings.Repeat(" ", wr.RowShift(y))
 		for x := 0; x < wr.Length; x++ {
-			pos := warehouse.Position{X: x, Y: y}
-			switch {
-			case wr.Packages.Exists(pos):
-				w += "📦"
-			case wr.ForkLifts.Exists(pos):
-				w += "👷"
-			case wr.Trucks.Exists(pos):
-				w += "🚚"
-			default:
-				w += "  "
+			pos := warehouse.Position{X: x, Y: y, Floor: floor}
+			if highlighted[pos] {
+				w += "\x1b[43m" + theme.tile(wr, labels, pos) + "\x1b[49m"
+			} else {
+				w += theme.tile(wr, labels, pos)
 			}
 		}
+		if hexagonal {
+			w += strings.Repeat(" ", 1-wr.RowShift(y))
+		}
 	}
-	w += "#\n" + strings.Repeat("#", wr.Length*2+3) + "\n"
+	w += "#\n" + strings.Repeat("#", width+3) + "\n"
 	return w
 }
 
@@ -38,13 +64,21 @@ func (sw showableWarehouse) output() string {
 	for _, e := range sw.Events {
 		switch e := e.(type) {
 		case warehouse.PickupPackage:
-			output += fmt.Sprintf("%s is is taking the package %s at position [%d,%d]\n", e.EmitterName(), e.PackageName(), e.AtPosition().X, e.AtPosition().Y)
+			output += fmt.Sprintf("%s is is taking the package %s at position %s\n", e.EmitterName(), e.PackageName(), sw.position(e.AtPosition()))
 		case warehouse.ForkliftWait:
-			output += fmt.Sprintf("%s is waiting at position [%d,%d]\n", e.EmitterName(), e.AtPosition().X, e.AtPosition().Y)
+			output += fmt.Sprintf("%s is waiting at position %s\n", e.EmitterName(), sw.position(e.AtPosition()))
 		case warehouse.ForkliftMove:
-			output += fmt.Sprintf("%s move from [%d,%d] to [%d,%d]\n", e.EmitterName(), e.AtPosition().X, e.AtPosition().Y, e.ToPosition().X, e.ToPosition().Y)
+			output += fmt.Sprintf("%s move from %s to %s\n", e.EmitterName(), sw.position(e.AtPosition()), sw.position(e.ToPosition()))
 		case warehouse.DeliverPackage:
 			output += fmt.Sprintf("%s is delivering the package %s\n", e.EmitterName(), e.PackageName())
+		case warehouse.UnloadPackage:
+			output += fmt.Sprintf("%s is unloading the package %s from %s\n", e.EmitterName(), e.PackageName(), e.TruckName())
+		case warehouse.StorePackage:
+			output += fmt.Sprintf("%s is storing the package %s in %s\n", e.EmitterName(), e.PackageName(), e.RackName())
+		case warehouse.StagePackage:
+			output += fmt.Sprintf("%s is staging the package %s for the order %s\n", e.EmitterName(), e.PackageName(), e.OrderName())
+		case warehouse.OrderComplete:
+			output += fmt.Sprintf("%s has loaded the whole order %s\n", e.EmitterName(), e.OrderName())
 		case warehouse.TruckWait:
 			output += fmt.Sprintf("%s is waiting. %d/%d\n", e.EmitterName(), e.ChargedWeight(), e.MaxWeight())
 		case warehouse.TruckGone:
@@ -56,6 +90,146 @@ func (sw showableWarehouse) output() string {
 	return output
 }
 
+// legend lists the entities on the map, drawn as in a theme, with their name, their position and their state
+func (sw showableWarehouse) legend(theme theme) string {
+	wr := sw.Warehouse
+	waits := sw.waitReasons()
+	type entity struct {
+		pos   warehouse.Position
+		name  string
+		state string
+	}
+	var entities []entity
+
+	for _, pos := range warehouse.SortedPositions(wr.ForkLifts) {
+		forklift := wr.ForkLifts[pos]
+		entities = append(entities, entity{pos, forklift.Name, forkliftState(forklift, waits)})
+	}
+	for _, pos := range warehouse.SortedPositions(wr.Trucks) {
+		entities = append(entities, entity{pos, wr.Trucks[pos].Name, truckState(wr.Trucks[pos])})
+	}
+	for _, pos := range warehouse.SortedPositions(wr.Packages) {
+		pack := wr.Packages[pos]
+		entities = append(entities, entity{pos, pack.Name, fmt.Sprintf("%s, %d", nameOf(colorToWeight, pack.Weight), pack.Weight)})
+	}
+	for _, pos := range warehouse.SortedPositions(wr.Racks) {
+		rack := wr.Racks[pos]
+		entities = append(entities, entity{pos, rack.Name, fmt.Sprintf("%d/%d slots used", len(rack.Stack), rack.Slots)})
+	}
+	for _, order := range wr.Orders {
+		state := fmt.Sprintf("%d/%d packages staged", len(order.Staged), len(order.Packages))
+		entities = append(entities, entity{order.Staging, order.Name, state})
+	}
+
+	// The names are padded by their characters, not by their bytes
+	width := 0
+	for _, entity := range entities {
+		if utf8.RuneCountInString(entity.name) > width {
+			width = utf8.RuneCountInString(entity.name)
+		}
+	}
+	labels := newTileLabels(wr)
+	output := "legend\n"
+	for _, entity := range entities {
+		padding := strings.Repeat(" ", width-utf8.RuneCountInString(entity.name))
+		output += fmt.Sprintf("%s %s%s %s %s\n", theme.tile(wr, labels, entity.pos), entity.name, padding,
+			sw.position(entity.pos), entity.state)
+	}
+	return output
+}
+
+// waitReasons why every ForkLift waiting during the cycle waited, by name
+func (sw showableWarehouse) waitReasons() map[string]string {
+	waits := make(map[string]string)
+	for _, event := range sw.Events {
+		if wait, isWait := event.(warehouse.ForkliftWait); isWait {
+			waits[wait.EmitterName()] = nameOf(nameToWaitReason, wait.Reason())
+		}
+	}
+	return waits
+}
+
+// forkliftState the Package a ForkLift carries, and why it waited if it did
+func forkliftState(forklift warehouse.ForkLift, waits map[string]string) string {
+	state := "empty"
+	if pack, carrying := forklift.Carrying(); carrying {
+		state = "carrying " + pack.Name
+	}
+	if reason, waiting := waits[forklift.Name]; waiting {
+		state += ", waiting " + reason
+	}
+	return state
+}
+
+// truckState the load of a Truck, and when it's back if it's gone
+func truckState(truck warehouse.Truck) string {
+	if truck.TimeUntilReturn != 0 {
+		return fmt.Sprintf("%d/%d, gone, back in %d", truck.CurrentWeight, truck.MaxWeight, truck.TimeUntilReturn)
+	}
+	return fmt.Sprintf("%d/%d, waiting", truck.CurrentWeight, truck.MaxWeight)
+}
+
+// position formats a Position, its floor is only given when the warehouse has several ones
+func (sw showableWarehouse) position(pos warehouse.Position) string {
+	if sw.Warehouse.FloorCount() == 1 {
+		return fmt.Sprintf("[%d,%d]", pos.X, pos.Y)
+	}
+	return fmt.Sprintf("[%d,%d,%d]", pos.X, pos.Y, pos.Floor)
+}
+
 func (sw showableWarehouse) String() string {
-	return sw.output() + sw.warehouseMap()
+	return sw.themed(emojiTheme)
+}
+
+// themed the events of the cycle followed by the warehouse drawn in a theme
+func (sw showableWarehouse) themed(theme theme) string {
+	return sw.output() + sw.warehouseMap(theme)
+}
+
+// putAwaySummary sums up where the packages unloaded from the trucks were stored
+// stored the names of the packages stored in every rack
+// final the warehouse at the last cycle
+type putAwaySummary struct {
+	stored map[string][]string
+	final  warehouse.Warehouse
+}
+
+func (summary *putAwaySummary) add(state warehouse.CycleState) {
+	if summary.stored == nil {
+		summary.stored = make(map[string][]string)
+	}
+	for _, e := range state.Events {
+		if store, ok := e.(warehouse.StorePackage); ok {
+			summary.stored[store.RackName()] = append(summary.stored[store.RackName()], store.PackageName())
+		}
+	}
+	summary.final = state.Warehouse
+}
+
+func (summary putAwaySummary) String() string {
+	output := "Put-away summary\n"
+	racks := make([]warehouse.Rack, 0, len(summary.final.Racks))
+	left := 0
+
+	for _, rack := range summary.final.Racks {
+		racks = append(racks, rack)
+	}
+	sort.Slice(racks, func(lhs, rhs int) bool { return racks[lhs].Name < racks[rhs].Name })
+
+	for _, rack := range racks {
+		output += fmt.Sprintf("%s: %d/%d slots used", rack.Name, len(rack.Stack), rack.Slots)
+		if stored := summary.stored[rack.Name]; len(stored) > 0 {
+			output += ", stored " + strings.Join(stored, ", ")
+		}
+		output += "\n"
+	}
+	for _, truck := range summary.final.Trucks {
+		left += len(truck.Cargo)
+	}
+	for _, forklift := range summary.final.ForkLifts {
+		if _, carrying := forklift.Carrying(); carrying {
+			left++
+		}
+	}
+	return output + fmt.Sprintf("%d packages left to put away\n", left)
 }
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// runStatistics sums up the CycleState of a run to compute its KPIs
+// lastDelivery the last cycle a Package was delivered to a Truck or stored in a Rack
+// pickedAt the cycle every Package on its way was first picked up
+// remaining the Package still to be delivered or stored at the last cycle, carried ones included
+// latency the cycles between the pick up and the delivery of every Package picked up and delivered, latencies of them
+// putAway the Truck come with the Package to store rather than taking the delivered ones
+type runStatistics struct {
+	cycles         uint
+	putAway        bool
+	lastDelivery   uint
+	deliveries     int
+	remaining      int
+	pickedAt       map[string]uint
+	latency        uint
+	latencies      int
+	fullTruckWaits int
+	forklifts      map[string]*forkliftStatistics
+	trucks         map[string]*truckStatistics
+}
+
+// forkliftStatistics what a ForkLift did during a run
+// moves the tiles it moved through, lift rides included
+// waits the cycles it waited, whatever the reason
+// idle the cycles it waited without doing anything, crossing a costly tile or reaching a rack level being work
+type forkliftStatistics struct {
+	moves int
+	waits int
+	idle  int
+}
+
+// truckStatistics the trips of a Truck during a run
+// fills the ratio of its maximum weight loaded for every trip
+// gone whether it's away being discharged
+// weight the Weight it was loaded with at the last cycle
+type truckStatistics struct {
+	maxWeight Weight
+	fills     []float64
+	gone      bool
+	weight    Weight
+}
+
+func newRunStatistics() *runStatistics {
+	return &runStatistics{
+		pickedAt:  make(map[string]uint),
+		forklifts: make(map[string]*forkliftStatistics),
+		trucks:    make(map[string]*truckStatistics),
+	}
+}
+
+func (stats *runStatistics) add(cycle uint, state CycleState) {
+	stats.cycles++
+	stats.putAway = state.Warehouse.Mission == PutAway
+	stats.remaining = remainingPackages(state.Warehouse)
+	for _, forklift := range state.Warehouse.ForkLifts {
+		if _, exists := stats.forklifts[forklift.Name]; !exists {
+			stats.forklifts[forklift.Name] = &forkliftStatistics{}
+		}
+		if _, carrying := forklift.Carrying(); carrying {
+			stats.remaining++
+		}
+	}
+	unloaded := make(map[string]bool)
+
+	for _, event := range state.Events {
+		switch event := event.(type) {
+		case ForkliftMove:
+			stats.forklifts[event.EmitterName()].moves++
+		case ForkliftWait:
+			stats.forklifts[event.EmitterName()].waits++
+			if event.Reason() != Crossing && event.Reason() != Retrieving {
+				stats.forklifts[event.EmitterName()].idle++
+			}
+			if event.Reason() == FullTruck {
+				stats.fullTruckWaits++
+			}
+		case PickupPackage:
+			stats.pickup(cycle, event.PackageName())
+		case UnloadPackage:
+			stats.pickup(cycle, event.PackageName())
+			unloaded[event.TruckName()] = true
+		case DeliverPackage:
+			stats.deliver(cycle, event.PackageName())
+		case StorePackage:
+			stats.deliver(cycle, event.PackageName())
+		case TruckWait:
+			stats.truck(event, false, event.ChargedWeight(), event.MaxWeight(), unloaded)
+		case TruckGone:
+			stats.truck(event, true, event.ChargedWeight(), event.MaxWeight(), unloaded)
+		}
+	}
+}
+
+// pickup keeps the cycle a Package is first picked up, a staged Package being picked up twice
+func (stats *runStatistics) pickup(cycle uint, name string) {
+	if _, picked := stats.pickedAt[name]; !picked {
+		stats.pickedAt[name] = cycle
+	}
+}
+
+func (stats *runStatistics) deliver(cycle uint, name string) {
+	stats.deliveries++
+	stats.lastDelivery = cycle
+	if picked, exists := stats.pickedAt[name]; exists {
+		stats.latency += cycle - picked
+		stats.latencies++
+		delete(stats.pickedAt, name)
+	}
+}
+
+// truck counts a trip when a Truck leaves, or when it comes back empty at once without being unloaded
+func (stats *runStatistics) truck(event Event, gone bool, weight Weight, maxWeight Weight, unloaded map[string]bool) {
+	truck, exists := stats.trucks[event.EmitterName()]
+	if !exists {
+		truck = &truckStatistics{maxWeight: maxWeight, gone: gone, weight: weight}
+		stats.trucks[event.EmitterName()] = truck
+		return
+	}
+
+	if gone && !truck.gone {
+		truck.fills = append(truck.fills, float64(weight)/float64(maxWeight))
+	} else if !gone && !truck.gone && weight == 0 && truck.weight > 0 && !unloaded[event.EmitterName()] {
+		truck.fills = append(truck.fills, float64(truck.weight)/float64(maxWeight))
+	}
+	truck.gone, truck.weight = gone, weight
+}
+
+// kpiReport the KPIs of a run, printed as text or JSON
+// Makespan the cycle of the last delivery once every Package is delivered, none when Finished is false
+// Finished every Package was delivered or stored before the end of the run
+// AverageLatency the average cycles between the pick up and the delivery of a Package
+// Remaining the Package still to be delivered or stored at the end of the run
+// FullTruckWaits the cycles the ForkLift waited for a Truck to be able to take their Package
+type kpiReport struct {
+	Cycles             uint             `json:"cycles"`
+	Makespan           uint             `json:"makespan,omitempty"`
+	Finished           bool             `json:"finished"`
+	Deliveries         int              `json:"deliveries"`
+	Remaining          int              `json:"remaining"`
+	DeliveriesPerCycle float64          `json:"deliveries_per_cycle"`
+	AverageLatency     float64          `json:"average_latency"`
+	TruckTrips         int              `json:"truck_trips"`
+	FullTruckWaits     int              `json:"full_truck_waits"`
+	ForkLifts          []forkliftReport `json:"forklifts"`
+	Trucks             []truckReport    `json:"trucks"`
+}
+
+// forkliftReport the KPIs of a ForkLift
+// Distance the tiles it moved through
+// Utilisation the share of the cycles it was working, its waits to cross a costly tile or to reach a rack level
+// included
+// WaitShare the share of the cycles it waited, whatever the reason
+type forkliftReport struct {
+	Name        string  `json:"name"`
+	Distance    int     `json:"distance"`
+	Utilisation float64 `json:"utilisation"`
+	WaitShare   float64 `json:"wait_share"`
+}
+
+// truckReport the KPIs of a Truck, with the fill ratio of every trip
+// Loading its last trip is the load it still has at its dock at the end of the run
+type truckReport struct {
+	Name       string    `json:"name"`
+	Trips      int       `json:"trips"`
+	FillRatios []float64 `json:"fill_ratios"`
+	Loading    bool      `json:"loading,omitempty"`
+}
+
+func (stats *runStatistics) report() kpiReport {
+	report := kpiReport{
+		Cycles:         stats.cycles,
+		Finished:       stats.remaining == 0,
+		Deliveries:     stats.deliveries,
+		Remaining:      stats.remaining,
+		FullTruckWaits: stats.fullTruckWaits,
+		ForkLifts:      []forkliftReport{},
+		Trucks:         []truckReport{},
+	}
+	if report.Finished {
+		report.Makespan = stats.lastDelivery
+	}
+	if stats.cycles != 0 {
+		report.DeliveriesPerCycle = float64(stats.deliveries) / float64(stats.cycles)
+	}
+	if stats.latencies != 0 {
+		report.AverageLatency = float64(stats.latency) / float64(stats.latencies)
+	}
+
+	for _, name := range sortedKeys(stats.forklifts) {
+		forklift := stats.forklifts[name]
+		forkliftReport := forkliftReport{Name: name, Distance: forklift.moves}
+		if stats.cycles != 0 {
+			forkliftReport.WaitShare = float64(forklift.waits) / float64(stats.cycles)
+			forkliftReport.Utilisation = 1 - float64(forklift.idle)/float64(stats.cycles)
+		}
+		report.ForkLifts = append(report.ForkLifts, forkliftReport)
+	}
+	for _, name := range sortedKeys(stats.trucks) {
+		truck := stats.trucks[name]
+		truckReport := truckReport{Name: name, FillRatios: append([]float64{}, truck.fills...)}
+		if !stats.putAway && !truck.gone && truck.weight > 0 {
+			truckReport.FillRatios = append(truckReport.FillRatios, float64(truck.weight)/float64(truck.maxWeight))
+			truckReport.Loading = true
+		}
+		truckReport.Trips = len(truckReport.FillRatios)
+		report.TruckTrips += truckReport.Trips
+		report.Trucks = append(report.Trucks, truckReport)
+	}
+	return report
+}
+
+func (report kpiReport) String() string {
+	output := "KPIs\n"
+	output += fmt.Sprintf("makespan: %s, %d run\n", report.makespanLabel(), report.Cycles)
+	output += fmt.Sprintf("deliveries: %d, %.3f per cycle, %d packages left\n", report.Deliveries,
+		report.DeliveriesPerCycle, report.Remaining)
+	output += fmt.Sprintf("average pickup to delivery latency: %.2f cycles\n", report.AverageLatency)
+	output += fmt.Sprintf("truck trips: %d\n", report.TruckTrips)
+	output += fmt.Sprintf("waiting for full trucks: %d cycles\n", report.FullTruckWaits)
+
+	for _, forklift := range report.ForkLifts {
+		output += fmt.Sprintf("%s: %d tiles, %.0f%% used, %.0f%% waiting\n", forklift.Name, forklift.Distance,
+			100*forklift.Utilisation, 100*forklift.WaitShare)
+	}
+	for _, truck := range report.Trucks {
+		fills := make([]string, 0, len(truck.FillRatios))
+		for _, fill := range truck.FillRatios {
+			fills = append(fills, fmt.Sprintf("%.0f%%", 100*fill))
+		}
+		output += fmt.Sprintf("%s: %d trips", truck.Name, truck.Trips)
+		if len(fills) != 0 {
+			output += ", filled " + strings.Join(fills, ", ")
+		}
+		if truck.Loading {
+			output += ", the last one still loading"
+		}
+		output += "\n"
+	}
+	return output
+}
+
+// makespanLabel the makespan in cycles, or unfinished when packages are left
+func (report kpiReport) makespanLabel() string {
+	if !report.Finished {
+		return "unfinished"
+	}
+	return fmt.Sprintf("%d cycles", report.Makespan)
+}
+
+// write writes the KPIs in a format, text or json
+func (report kpiReport) write(file io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	_, err := io.WriteString(file, report.String())
+	return err
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// sweepParameter a parameter of a scenario varied by a sweep, the other ones keeping the values of the scenario
+// name the option of the sweep giving its values
+// check checks a value of the parameter before anything is run
+// apply changes a Warehouse to a value of the parameter
+type sweepParameter struct {
+	name  string
+	check func(value int) error
+	apply func(wh *Warehouse, value int) error
+}
+
+var sweepParameters = []sweepParameter{
+	{name: "forklifts", check: checkForkliftCount, apply: setForkliftCount},
+	{name: "capacity", check: checkTruckCapacity, apply: setTruckCapacity},
+	{name: "cooldown", check: checkTruckCooldown, apply: setTruckCooldown},
+}
+
+// sweepPoint a value of a swept parameter and the KPIs of the scenario run with it
+type sweepPoint struct {
+	value  int
+	result benchResult
+}
+
+// sweep runs the sweep subcommand, running a scenario over the ranges of values of some of its parameters and
+// printing the KPI curves they draw
+func sweep(arguments []string) error {
+	var plannerName string
+	var workers int
+	var timeout time.Duration
+	var csvOutput bool
+	ranges := make(map[string]*string)
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	ranges["forklifts"] = flags.String("forklifts", "", "forklift counts, the forklifts added standing next to the others")
+	ranges["capacity"] = flags.String("capacity", "", "maximum weights of every truck")
+	ranges["cooldown"] = flags.String("cooldown", "", "cycles every truck is away to be discharged")
+	flags.StringVar(&plannerName, "planner", "dfs", "planner finding the paths, dfs or dijkstra")
+	flags.IntVar(&workers, "workers", runtime.NumCPU(), "number of runs in parallel")
+	flags.DurationVar(&timeout, "timeout", time.Minute, "time after which a run is given up, never when 0")
+	flags.BoolVar(&csvOutput, "csv", false, "write the curves as CSV instead of tables")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gotrans sweep [options] <scenario>")
+		_, _ = fmt.Fprintln(flags.Output(), "The values of a parameter are a range min:max[:step] or a list separated by commas")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); errors.Is(err, flag.ErrHelp) {
+		// The usage asked for is printed by the flags
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("sweep expects a scenario")
+	}
+	if workers < 1 {
+		return errors.New("the workers should be a positive number")
+	}
+	planner, exists := nameToPlanner[strings.ToLower(plannerName)]
+	if !exists {
+		return fmt.Errorf("unknown planner %q, expected dfs or dijkstra", plannerName)
+	}
+
+	scenarios, err := readBenchScenarios(flags.Args())
+	if err != nil {
+		return err
+	}
+	base := scenarios[0]
+
+	// Every range is checked before the first run
+	sweptValues := make(map[string][]int)
+	var swept []sweepParameter
+	for _, parameter := range sweepParameters {
+		if *ranges[parameter.name] == "" {
+			continue
+		}
+		parsed, err := parseSweepValues(*ranges[parameter.name])
+		if err != nil {
+			return fmt.Errorf("-%s: %w", parameter.name, err)
+		}
+		for _, value := range parsed {
+			if err = parameter.check(value); err != nil {
+				return fmt.Errorf("-%s: %w", parameter.name, err)
+			}
+		}
+		sweptValues[parameter.name] = parsed
+		swept = append(swept, parameter)
+	}
+	if len(swept) == 0 {
+		flags.Usage()
+		return errors.New("sweep expects the values of a parameter at least")
+	}
+
+	curves := make(map[string][]sweepPoint)
+	for _, parameter := range swept {
+		values := sweptValues[parameter.name]
+		points := make([]benchScenario, 0, len(values))
+		for _, value := range values {
+			wh := base.warehouse.Clone()
+			if err = parameter.apply(&wh, value); err != nil {
+				return fmt.Errorf("%s=%d: %w", parameter.name, value, err)
+			}
+			points = append(points, benchScenario{
+				name:      fmt.Sprintf("%s=%d", parameter.name, value),
+				warehouse: wh,
+				cycles:    base.cycles,
+			})
+		}
+		for index, result := range runBench(points, []Planner{planner}, workers, timeout) {
+			curves[parameter.name] = append(curves[parameter.name], sweepPoint{value: values[index], result: result})
+		}
+	}
+
+	if csvOutput {
+		return writeSweepCSV(os.Stdout, swept, curves)
+	}
+	for _, parameter := range swept {
+		fmt.Print(sweepTable(parameter.name, curves[parameter.name]))
+	}
+	return nil
+}
+
+// parseSweepValues parses the values of a parameter, a range min:max[:step] or a list separated by commas
+func parseSweepValues(text string) ([]int, error) {
+	var values []int
+
+	if bounds := strings.Split(text, ":"); len(bounds) > 1 {
+		numbers := make([]int, 0, 3)
+		for _, bound := range bounds {
+			number, err := strconv.Atoi(bound)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q, expected min:max[:step]", text)
+			}
+			numbers = append(numbers, number)
+		}
+		step := 1
+		if len(numbers) == 3 {
+			step = numbers[2]
+		}
+		if len(numbers) > 3 || step < 1 || numbers[0] > numbers[1] {
+			return nil, fmt.Errorf("invalid range %q, expected min:max[:step]", text)
+		}
+		for value := numbers[0]; value <= numbers[1]; value += step {
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	for _, item := range strings.Split(text, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// setForkliftCount keeps the first ForkLift in reading order, or adds some on the empty tiles the nearest to the
+// other ones, so that they start from the same area
+func checkForkliftCount(count int) error {
+	if count < 1 {
+		return errors.New("a warehouse needs a forklift at least")
+	}
+	return nil
+}
+
+func setForkliftCount(wh *Warehouse, count int) error {
+	positions := SortedPositions(wh.ForkLifts)
+	if count <= len(positions) {
+		for _, pos := range positions[count:] {
+			delete(wh.ForkLifts, pos)
+		}
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for _, forklift := range wh.ForkLifts {
+		names[forklift.Name] = true
+	}
+	number := 1
+	for _, pos := range emptyTilesAround(*wh, positions) {
+		if len(wh.ForkLifts) == count {
+			break
+		}
+		for names[fmt.Sprintf("f%d", number)] {
+			number++
+		}
+		names[fmt.Sprintf("f%d", number)] = true
+		wh.ForkLifts[pos] = ForkLift{Name: fmt.Sprintf("f%d", number)}
+	}
+	if len(wh.ForkLifts) < count {
+		return errors.New("not enough empty tiles for the forklifts")
+	}
+	return nil
+}
+
+// emptyTilesAround returns the empty tiles of a floor from the nearest to the starting tiles, through the empty
+// tiles, from the first empty tile in reading order without any starting tile
+func emptyTilesAround(wh Warehouse, starts []Position) []Position {
+	if len(starts) == 0 {
+		for y := 0; y < wh.Height && len(starts) == 0; y++ {
+			for x := 0; x < wh.Length && len(starts) == 0; x++ {
+				if pos := (Position{X: x, Y: y}); isEmptyTile(wh, pos) {
+					starts = append(starts, pos)
+				}
+			}
+		}
+	}
+
+	var empty []Position
+	seen := make(map[Position]bool)
+	queue := append([]Position(nil), starts...)
+	for _, pos := range starts {
+		seen[pos] = true
+	}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		if isEmptyTile(wh, pos) {
+			empty = append(empty, pos)
+		}
+		for _, neighbour := range sideNeighbours(pos) {
+			if !seen[neighbour] && isEmptyTile(wh, neighbour) {
+				seen[neighbour] = true
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+	return empty
+}
+
+// sideNeighbours the tiles of the same floor sharing a side with a tile
+func sideNeighbours(pos Position) []Position {
+	return []Position{
+		{X: pos.X, Y: pos.Y - 1, Floor: pos.Floor}, {X: pos.X + 1, Y: pos.Y, Floor: pos.Floor},
+		{X: pos.X, Y: pos.Y + 1, Floor: pos.Floor}, {X: pos.X - 1, Y: pos.Y, Floor: pos.Floor},
+	}
+}
+
+// isEmptyTile checks if a tile of a Warehouse is free to place a ForkLift or a Truck on
+func isEmptyTile(wh Warehouse, pos Position) bool {
+	_, isLift := wh.LiftAt(pos)
+	return pos.X >= 0 && pos.X < wh.Length && pos.Y >= 0 && pos.Y < wh.Height && pos.Floor >= 0 &&
+		pos.Floor < wh.FloorCount() && !wh.Walls[pos] && !wh.SomethingExistsAt(pos) && wh.StagingAt(pos) == -1 &&
+		!isLift
+}
+
+func checkTruckCapacity(capacity int) error {
+	if capacity < 1 {
+		return errors.New("the capacity should be a positive number")
+	}
+	return nil
+}
+
+// setTruckCapacity sets the maximum Weight of every Truck, which must still hold its cargo and its orders
+func setTruckCapacity(wh *Warehouse, capacity int) error {
+	for pos, truck := range wh.Trucks {
+		truck.MaxWeight = Weight(capacity)
+		if truck.CurrentWeight > truck.MaxWeight {
+			return fmt.Errorf("truck %s: too heavy for the truck", truck.Name)
+		}
+		wh.Trucks[pos] = truck
+	}
+	for _, order := range wh.Orders {
+		if order.Weight > Weight(capacity) {
+			return fmt.Errorf("order %s: too heavy for the truck %s", order.Name, order.Truck)
+		}
+	}
+	return nil
+}
+
+// setTruckCooldown sets the cycles every Truck is away to be discharged
+func checkTruckCooldown(cooldown int) error {
+	if cooldown < 0 {
+		return errors.New("the cooldown of a truck can't be negative")
+	}
+	return nil
+}
+
+func setTruckCooldown(wh *Warehouse, cooldown int) error {
+	for pos, truck := range wh.Trucks {
+		truck.ElapseDischargingTime = cooldown
+		wh.Trucks[pos] = truck
+	}
+	return nil
+}
+
+// kneePoint returns the index of the point of a curve the furthest from the line joining its ends, once both axes
+// are scaled to [0, 1], where adding to the parameter stops paying off, -1 when there are less than 3 points
+func kneePoint(xs []float64, ys []float64) int {
+	if len(xs) < 3 {
+		return -1
+	}
+	scale := func(values []float64) []float64 {
+		low, high := values[0], values[0]
+		for _, value := range values {
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+		scaled := make([]float64, len(values))
+		for index, value := range values {
+			if high != low {
+				scaled[index] = (value - low) / (high - low)
+			}
+		}
+		return scaled
+	}
+	xs, ys = scale(xs), scale(ys)
+
+	last := len(xs) - 1
+	dx, dy := xs[last]-xs[0], ys[last]-ys[0]
+	knee, furthest := -1, 0.0
+	for index := 1; index < last; index++ {
+		distance := math.Abs(dy*(xs[index]-xs[0])-dx*(ys[index]-ys[0])) / math.Hypot(dx, dy)
+		if distance > furthest {
+			knee, furthest = index, distance
+		}
+	}
+	return knee
+}
+
+// sweepKnee returns the point of a curve at the knee of its makespan, the runs given up or unfinished being left out
+func sweepKnee(points []sweepPoint) (sweepPoint, bool) {
+	var finished []sweepPoint
+	var xs, ys []float64
+	for _, point := range points {
+		if !point.result.givenUp && point.result.report.Finished {
+			finished = append(finished, point)
+			xs = append(xs, float64(point.value))
+			ys = append(ys, float64(point.result.report.Makespan))
+		}
+	}
+	if knee := kneePoint(xs, ys); knee != -1 {
+		return finished[knee], true
+	}
+	return sweepPoint{}, false
+}
+
+// sweepTable prints the KPIs of every value of a parameter, followed by the knee of the makespan curve
+func sweepTable(name string, points []sweepPoint) string {
+	var output strings.Builder
+	table := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(table, "%s\tmakespan\tdeliveries\tdeliveries per cycle\taverage latency\tutilisation\t"+
+		"full truck waits\ttruck trips\n", name)
+	for _, point := range points {
+		if point.result.givenUp {
+			_, _ = fmt.Fprintf(table, "%d\tgiven up\n", point.value)
+			continue
+		}
+		report := point.result.report
+		_, _ = fmt.Fprintf(table, "%d\t%s\t%d\t%.3f\t%.2f\t%.2f\t%d\t%d\n", point.value, report.makespanLabel(),
+			report.Deliveries, report.DeliveriesPerCycle, report.AverageLatency, averageUtilisation(report),
+			report.FullTruckWaits, report.TruckTrips)
+	}
+	_ = table.Flush()
+
+	if knee, found := sweepKnee(points); found {
+		output.WriteString(fmt.Sprintf("knee of the makespan at %s=%d, %d cycles\n", name, knee.value,
+			knee.result.report.Makespan))
+	}
+	output.WriteString("\n")
+	return output.String()
+}
+
+// writeSweepCSV writes the curves as CSV, a row for every value of every parameter
+func writeSweepCSV(file io.Writer, swept []sweepParameter, curves map[string][]sweepPoint) error {
+	writer := csv.NewWriter(file)
+	header := []string{
+		"parameter", "value", "makespan", "deliveries", "deliveries_per_cycle", "average_latency", "utilisation",
+		"full_truck_waits", "truck_trips", "knee",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, parameter := range swept {
+		knee, found := sweepKnee(curves[parameter.name])
+		for _, point := range curves[parameter.name] {
+			row := []string{parameter.name, strconv.Itoa(point.value)}
+			if point.result.givenUp {
+				row = append(row, "", "", "", "", "", "", "", "false")
+			} else {
+				report := point.result.report
+				makespan := ""
+				if report.Finished {
+					makespan = strconv.FormatUint(uint64(report.Makespan), 10)
+				}
+				row = append(row,
+					makespan,
+					strconv.Itoa(report.Deliveries),
+					strconv.FormatFloat(report.DeliveriesPerCycle, 'f', 3, 64),
+					strconv.FormatFloat(report.AverageLatency, 'f', 2, 64),
+					strconv.FormatFloat(averageUtilisation(report), 'f', 2, 64),
+					strconv.Itoa(report.FullTruckWaits),
+					strconv.Itoa(report.TruckTrips),
+					strconv.FormatBool(found && knee.value == point.value),
+				)
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Harmos274/gotrans/warehouse"
+)
+
+// theme how the tiles of the warehouse are drawn on the terminal, every tile taking 2 columns
+type theme int
+
+// The themes of the terminal
+// emojiTheme draws the entities as wide emoji, the lanes being drawn with the ASCII arrows as the Unicode ones are
+// one or two columns wide depending on the terminal
+// asciiTheme draws the entities as the letter of their kind followed by their label, the letter being upper case
+// when a ForkLift carries a Package and when a Truck is at its dock
+// ansiTheme draws the letters of the ASCII theme in colours, the packages in their own and the trucks in the one of
+// their load
+const (
+	emojiTheme theme = iota
+	asciiTheme
+	ansiTheme
+)
+
+var nameToTheme = map[string]theme{
+	"emoji": emojiTheme,
+	"ascii": asciiTheme,
+	"ansi":  ansiTheme,
+}
+
+// colorToANSI the ANSI colour of the packages of every color
+var colorToANSI = map[string]string{
+	"yellow": "\x1b[33m",
+	"green":  "\x1b[32m",
+	"blue":   "\x1b[34m",
+}
+
+// asciiArrows the ASCII arrows of the lanes, the diagonal ones drawn with both of their directions
+var asciiArrows = map[warehouse.Exits]string{
+	warehouse.ExitUp:        "^ ",
+	warehouse.ExitRight:     "> ",
+	warehouse.ExitDown:      "v ",
+	warehouse.ExitLeft:      "< ",
+	warehouse.ExitUpRight:   "^>",
+	warehouse.ExitDownRight: "v>",
+	warehouse.ExitDownLeft:  "<v",
+	warehouse.ExitUpLeft:    "<^",
+}
+
+// labelCharacters the labels given in turn to the entities whose name doesn't end with an ASCII letter or digit
+// free among the entities of their kind
+const labelCharacters = "123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0"
+
+// tileLabels the single character telling apart the entities of every kind in the ASCII themes, by the letter of
+// the kind then by name
+type tileLabels map[byte]map[string]string
+
+// newTileLabels labels the packages, the forklifts, the trucks and the lifts of a Warehouse
+func newTileLabels(wh warehouse.Warehouse) tileLabels {
+	names := make(map[byte][]string)
+	for _, pack := range wh.Packages {
+		names['p'] = append(names['p'], pack.Name)
+	}
+	for _, forklift := range wh.ForkLifts {
+		names['f'] = append(names['f'], forklift.Name)
+	}
+	for _, truck := range wh.Trucks {
+		names['t'] = append(names['t'], truck.Name)
+	}
+	for _, lift := range wh.Lifts {
+		names['l'] = append(names['l'], lift.Name)
+	}
+
+	labels := make(tileLabels)
+	for kind, kindNames := range names {
+		sort.Strings(kindNames)
+		labels[kind] = uniqueLabels(kindNames)
+	}
+	return labels
+}
+
+// uniqueLabels gives every name the last character of it when it's an ASCII letter or digit no other name was given,
+// the next free character of labelCharacters otherwise, ? once they're all taken
+func uniqueLabels(names []string) map[string]string {
+	labels := make(map[string]string, len(names))
+	taken := make(map[rune]bool)
+	var collided []string
+
+	for _, name := range names {
+		last, _ := utf8.DecodeLastRuneInString(name)
+		if last < unicode.MaxASCII && (unicode.IsLetter(last) || unicode.IsDigit(last)) && !taken[last] {
+			labels[name] = string(last)
+			taken[last] = true
+		} else {
+			collided = append(collided, name)
+		}
+	}
+	next := 0
+	for _, name := range collided {
+		for next < len(labelCharacters) && taken[rune(labelCharacters[next])] {
+			next++
+		}
+		if next == len(labelCharacters) {
+			labels[name] = "?"
+			continue
+		}
+		labels[name] = labelCharacters[next : next+1]
+		taken[rune(labelCharacters[next])] = true
+	}
+	return labels
+}
+
+// tile draws what stands on a tile of a Warehouse
+func (theme theme) tile(wh warehouse.Warehouse, labels tileLabels, pos warehouse.Position) string {
+	lift, isLift := wh.LiftAt(pos)
+	staging := wh.StagingAt(pos)
+
+	switch {
+	case wh.Walls[pos]:
+		return theme.cell("🧱", "##", "\x1b[90m")
+	case wh.Packages.Exists(pos):
+		pack := wh.Packages[pos]
+		return theme.cell("📦", "p"+labels['p'][pack.Name], colorToANSI[nameOf(colorToWeight, pack.Weight)])
+	case wh.ForkLifts.Exists(pos):
+		forklift := wh.ForkLifts[pos]
+		if _, carrying := forklift.Carrying(); carrying {
+			return theme.cell("🚜", "F"+labels['f'][forklift.Name], "\x1b[1;93m")
+		}
+		return theme.cell("👷", "f"+labels['f'][forklift.Name], "\x1b[93m")
+	case wh.Trucks.Exists(pos):
+		truck := wh.Trucks[pos]
+		fill := 0
+		if truck.MaxWeight > 0 {
+			fill = int(truck.CurrentWeight * 10 / truck.MaxWeight)
+		}
+		if truck.TimeUntilReturn != 0 {
+			return theme.cell("💨", "t"+labels['t'][truck.Name], "\x1b[2;36m")
+		}
+		return theme.cell(fillToEmoji(fill), "T"+labels['t'][truck.Name], fillToANSI(fill))
+	case wh.Racks.Exists(pos):
+		return theme.cell("📚", "R"+digitLabel(len(wh.Racks[pos].Stack)), "\x1b[35m")
+	case staging != -1:
+		return theme.cell("📥", "S"+digitLabel(len(wh.Orders[staging].Staged)), "\x1b[32m")
+	case isLift:
+		return theme.cell("🆙", "L"+labels['l'][lift.Name], "\x1b[1;37m")
+	case theme == emojiTheme && wh.ExitsAt(pos) == warehouse.AllExits:
+		return "  "
+	default:
+		exits := asciiExits(wh.ExitsAt(pos))
+		return theme.cell(exits, exits, "\x1b[90m")
+	}
+}
+
+// cell draws a tile as its emoji, or as its 2 letters, in colour for the ANSI theme
+func (theme theme) cell(emoji string, letters string, color string) string {
+	switch theme {
+	case asciiTheme:
+		return letters
+	case ansiTheme:
+		return color + letters + "\x1b[22;39m"
+	default:
+		return emoji
+	}
+}
+
+// fillToANSI the ANSI colour of a Truck at its dock filled to tenths of its maximum weight, green up to half
+// of it, yellow above and red once full
+func fillToANSI(fill int) string {
+	switch {
+	case fill < 5:
+		return "\x1b[1;32m"
+	case fill < 10:
+		return "\x1b[1;33m"
+	default:
+		return "\x1b[1;31m"
+	}
+}
+
+// fillToEmoji the emoji of a Truck at its dock filled to tenths of its maximum weight, on the levels of fillToANSI
+func fillToEmoji(fill int) string {
+	switch {
+	case fill < 5:
+		return "🚚"
+	case fill < 10:
+		return "🚛"
+	default:
+		return "🈵"
+	}
+}
+
+func asciiExits(exits warehouse.Exits) string {
+	if flow, ok := exits.Flow(); ok {
+		return asciiArrows[flow]
+	}
+	if exits != warehouse.AllExits {
+		return ": "
+	}
+	return ". "
+}
+
+// digitLabel a count in a single column, + above 9
+func digitLabel(count int) string {
+	if count > 9 {
+		return "+"
+	}
+	return strconv.Itoa(count)
+}
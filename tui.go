@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/Harmos274/gotrans/warehouse"
+)
+
+// tuiSpeeds the delays between two cycles played by the terminal UI, from the slowest to the quickest
+var tuiSpeeds = []time.Duration{
+	time.Second, 500 * time.Millisecond, 250 * time.Millisecond, 100 * time.Millisecond, 50 * time.Millisecond,
+	20 * time.Millisecond,
+}
+
+const tuiKeys = "space play/pause  ←/→ step  +/- speed  tab select  ↑/↓ scroll events  q quit"
+
+// tui a full-screen terminal UI redrawing the cycles of a simulation in place
+// states every CycleState run so far, the first one being the Warehouse before the first cycle
+// logs the lines of the event log of every state, one per Event
+// violations the rules broken during every state, shown in red in the event log after its events
+// next runs the next cycle of the simulation, with the rules it broke, false once it's over
+// current the index of the state shown
+// speed the index of the delay between two cycles played in tuiSpeeds
+// selected the name of the ForkLift or Truck highlighted, none when empty
+// scroll the number of lines the event log is scrolled up by
+// theme how the warehouse is drawn
+// rows and columns the size of the terminal, read again when it's resized
+type tui struct {
+	states     []warehouse.CycleState
+	logs       [][]string
+	violations [][]string
+	cycles     uint
+	next       func() (warehouse.CycleState, []string, bool)
+	current    int
+	playing    bool
+	speed      int
+	selected   string
+	scroll     int
+	theme      theme
+	rows       int
+	columns    int
+}
+
+// runTUI shows a simulation in a full-screen terminal UI from a cycle until the user quits it, the terminal being
+// switched to raw mode with stty for the keys to be read as they're hit
+func runTUI(initial warehouse.Warehouse, cycles uint, start uint, theme theme,
+	next func() (warehouse.CycleState, []string, bool),
+) error {
+	saved, err := stty("-g")
+	if err != nil {
+		return errors.New("the interactive mode needs a terminal")
+	}
+	if _, err = stty("raw", "-echo"); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = stty(saved)
+	}()
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	ui := &tui{
+		states:     []warehouse.CycleState{{Warehouse: initial.Clone()}},
+		logs:       [][]string{nil},
+		violations: [][]string{nil},
+		cycles:     cycles,
+		next:       next,
+		speed:      2,
+		theme:      theme,
+	}
+	ui.rows, ui.columns = terminalSize()
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+	for ui.current < int(start) && ui.current == len(ui.states)-1 {
+		ui.forward()
+	}
+	keys := make(chan string)
+	go readKeys(keys)
+
+	for {
+		ui.draw()
+		var tick <-chan time.Time
+		if ui.playing {
+			tick = time.After(tuiSpeeds[ui.speed])
+		}
+
+		select {
+		case key := <-keys:
+			if !ui.handle(key) {
+				return nil
+			}
+		case <-tick:
+			ui.forward()
+		case <-resized:
+			ui.rows, ui.columns = terminalSize()
+		}
+	}
+}
+
+// stty runs stty on the terminal of the standard input
+func stty(arguments ...string) (string, error) {
+	command := exec.Command("stty", arguments...)
+	command.Stdin = os.Stdin
+	output, err := command.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// terminalSize the rows and the columns of the terminal, 24 by 80 when stty can't tell them
+func terminalSize() (int, int) {
+	size, err := stty("size")
+	if rows, columns, found := strings.Cut(size, " "); err == nil && found {
+		height, heightErr := strconv.Atoi(rows)
+		width, widthErr := strconv.Atoi(columns)
+		if heightErr == nil && widthErr == nil && height > 0 && width > 0 {
+			return height, width
+		}
+	}
+	return 24, 80
+}
+
+// readKeys reads the keys hit on the terminal, the escape sequences of the arrows being named after them
+func readKeys(keys chan<- string) {
+	arrows := map[string]string{"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left"}
+	buffer := make([]byte, 16)
+
+	for {
+		read, err := os.Stdin.Read(buffer)
+		if err != nil {
+			keys <- "q"
+			return
+		}
+		input := string(buffer[:read])
+		if arrow, isArrow := arrows[input]; isArrow {
+			keys <- arrow
+			continue
+		}
+		for _, key := range input {
+			keys <- string(key)
+		}
+	}
+}
+
+// handle applies a key hit, false when it quits the UI
+func (ui *tui) handle(key string) bool {
+	switch key {
+	case "q", "\x03":
+		return false
+	case " ":
+		ui.playing = !ui.playing
+	case "right", "l":
+		ui.playing = false
+		ui.forward()
+	case "left", "h":
+		ui.playing = false
+		if ui.current > 0 {
+			ui.current--
+			ui.scroll = 0
+		}
+	case "+", "=":
+		if ui.speed < len(tuiSpeeds)-1 {
+			ui.speed++
+		}
+	case "-":
+		if ui.speed > 0 {
+			ui.speed--
+		}
+	case "\t":
+		ui.selectNext()
+	case "up", "k":
+		ui.scroll++
+	case "down", "j":
+		if ui.scroll > 0 {
+			ui.scroll--
+		}
+	}
+	return true
+}
+
+// forward shows the next cycle, running it when it wasn't yet, the playing stopping once the simulation is over
+func (ui *tui) forward() {
+	if ui.current == len(ui.states)-1 {
+		state, violations, running := ui.next()
+		if !running {
+			ui.playing = false
+			return
+		}
+		ui.states = append(ui.states, state)
+		ui.violations = append(ui.violations, violations)
+		ui.logs = append(ui.logs, strings.Split(strings.TrimSuffix(showableWarehouse(state).output(), "\n"), "\n"))
+	}
+	ui.current++
+	ui.scroll = 0
+}
+
+// entityNames the names of the ForkLift then of the Truck, in alphabetical order, that can be selected
+func (ui *tui) entityNames() []string {
+	wh := ui.states[ui.current].Warehouse
+	var forklifts, trucks []string
+	for _, forklift := range wh.ForkLifts {
+		forklifts = append(forklifts, forklift.Name)
+	}
+	for _, truck := range wh.Trucks {
+		trucks = append(trucks, truck.Name)
+	}
+	sort.Strings(forklifts)
+	sort.Strings(trucks)
+	return append(forklifts, trucks...)
+}
+
+// selectNext selects the entity following the selected one, none after the last one
+func (ui *tui) selectNext() {
+	names := ui.entityNames()
+	index := -1
+	for current, name := range names {
+		if name == ui.selected {
+			index = current
+		}
+	}
+	if index+1 < len(names) {
+		ui.selected = names[index+1]
+	} else {
+		ui.selected = ""
+	}
+}
+
+func (ui *tui) draw() {
+	rows, columns := ui.rows, ui.columns
+	state := ui.states[ui.current]
+	sw := showableWarehouse(state)
+
+	status := "paused"
+	if ui.playing {
+		status = "playing"
+	}
+	lines := []string{
+		fmt.Sprintf("tour %d/%d  %s  %v per cycle", ui.current, ui.cycles, status, tuiSpeeds[ui.speed]),
+		tuiKeys,
+	}
+	highlighted := make(map[warehouse.Position]bool)
+	for pos, forklift := range state.Warehouse.ForkLifts {
+		highlighted[pos] = forklift.Name == ui.selected
+	}
+	for pos, truck := range state.Warehouse.Trucks {
+		highlighted[pos] = truck.Name == ui.selected
+	}
+	mapLines := strings.Split(strings.TrimSuffix(sw.highlightedMap(ui.theme, highlighted), "\n"), "\n")
+	lines = append(lines, mapLines...)
+	panel := ui.panel()
+	lines = append(lines, panel...)
+
+	lines = append(lines, "events")
+	height := rows - len(lines)
+	if height < 0 {
+		height = 0
+	}
+	lines = append(lines, ui.eventLog(height)...)
+	// What doesn't fit in the terminal is cut for the screen not to scroll, the frame being drawn in place
+	if len(lines) > rows {
+		lines = lines[:rows]
+	}
+
+	frame := "\x1b[H"
+	for index, line := range lines {
+		frame += truncate(line, columns) + "\x1b[K"
+		if index < len(lines)-1 {
+			frame += "\r\n"
+		}
+	}
+	fmt.Print(frame + "\x1b[J")
+}
+
+// panel lists the ForkLift with what they carry and the Truck with their load, the selected one in reverse video
+func (ui *tui) panel() []string {
+	state := ui.states[ui.current]
+	sw := showableWarehouse(state)
+	waits := sw.waitReasons()
+
+	var lines []string
+	for _, pos := range warehouse.SortedPositions(state.Warehouse.ForkLifts) {
+		forklift := state.Warehouse.ForkLifts[pos]
+		line := fmt.Sprintf("%-8s %s %s", forklift.Name, sw.position(pos), forkliftState(forklift, waits))
+		lines = append(lines, ui.selectable(forklift.Name, line))
+	}
+	for _, pos := range warehouse.SortedPositions(state.Warehouse.Trucks) {
+		truck := state.Warehouse.Trucks[pos]
+		line := fmt.Sprintf("%-8s %s %s", truck.Name, sw.position(pos), truckState(truck))
+		lines = append(lines, ui.selectable(truck.Name, line))
+	}
+	return lines
+}
+
+// selectable writes a line in reverse video when it's the one of the selected entity
+func (ui *tui) selectable(name string, line string) string {
+	if name == ui.selected {
+		return "\x1b[7m" + line + "\x1b[27m"
+	}
+	return line
+}
+
+// eventLog the last lines of the event log up to the cycle shown, scrolled up by the scroll of the UI, the events
+// of the selected entity in reverse video and the violations in red
+func (ui *tui) eventLog(height int) []string {
+	var lines []string
+	for cycle := 1; cycle <= ui.current; cycle++ {
+		for index, event := range ui.states[cycle].Events {
+			if index < len(ui.logs[cycle]) {
+				lines = append(lines, ui.selectable(event.EmitterName(), fmt.Sprintf("%d: %s", cycle, ui.logs[cycle][index])))
+			}
+		}
+		for _, violation := range ui.violations[cycle] {
+			lines = append(lines, "\x1b[31m"+violation+"\x1b[39m")
+		}
+	}
+
+	if ui.scroll > len(lines)-height {
+		ui.scroll = len(lines) - height
+	}
+	if ui.scroll < 0 {
+		ui.scroll = 0
+	}
+	end := len(lines) - ui.scroll
+	start := end - height
+	if start < 0 {
+		start = 0
+	}
+	return lines[start:end]
+}
+
+// truncate cuts a line to the width of the terminal, counting the columns of the characters outside the ANSI escape
+// codes, which are all kept for the colours to be reset
+func truncate(line string, width int) string {
+	var cut strings.Builder
+	count, escaping := 0, false
+	for _, char := range line {
+		switch {
+		case char == '\x1b':
+			escaping = true
+		case escaping:
+			escaping = char < '@' || char > '~' || char == '['
+		case count+columnsOf(char) > width:
+			// The following characters are skipped too, a narrower one must not be drawn after a cut wide one
+			count = width
+			continue
+		default:
+			count += columnsOf(char)
+		}
+		cut.WriteRune(char)
+	}
+	return cut.String()
+}
+
+// columnsOf the columns a character takes on the terminal, 2 for the emoji and the East Asian wide characters, none
+// for the combining marks and the variation selectors
+func columnsOf(char rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, char) || char == '\u200d' || (char >= '\ufe00' && char <= '\ufe0f'):
+		return 0
+	case char >= 0x1100 && char <= 0x115f, char >= 0x2e80 && char <= 0xa4cf, char >= 0xac00 && char <= 0xd7a3,
+		char >= 0xf900 && char <= 0xfaff, char >= 0xfe30 && char <= 0xfe4f, char >= 0xff00 && char <= 0xff60,
+		char >= 0xffe0 && char <= 0xffe6, char >= 0x1f000 && char <= 0x1faff, char >= 0x20000 && char <= 0x3fffd:
+		return 2
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,588 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// violation a rule broken by an Event of a cycle
+type violation struct {
+	cycle   uint
+	message string
+}
+
+func (v violation) String() string {
+	return fmt.Sprintf("cycle %d: %s", v.cycle, v.message)
+}
+
+// validator checks the Event of a cleaning against the rules of the Warehouse, keeping its own account of where
+// every ForkLift and Package is, independently of the simulation
+// layout the scenario, giving the tiles, the Truck, the Rack and the staging tiles, which never move
+// forklifts the Position of every ForkLift, by name
+// carried the Package carried by every ForkLift, by name
+// floor, racks, staged and cargo the Package on the floor, in every Rack, on the staging tile of every Order and in
+// every Truck, by name
+// delivered the names of the Package loaded in the Truck, with the Weight loaded in every Truck and the Truck gone
+// initial the number of Package with every name, which must stay the same
+// unbalanced the last report about the Package conservation, not to repeat it every cycle
+type validator struct {
+	layout     Warehouse
+	cycle      uint
+	forklifts  map[string]Position
+	carried    map[string]Package
+	floor      map[Position]Package
+	racks      map[string][]Package
+	staged     map[string][]Package
+	cargo      map[string][]Package
+	delivered  map[string]int
+	loads      map[string]Weight
+	gone       map[string]bool
+	initial    map[string]int
+	unbalanced string
+	violations []violation
+}
+
+// newValidator starts checking a Warehouse after its first cycles, 0 unless it's resumed from a checkpoint
+func newValidator(wh Warehouse, cycle uint) *validator {
+	v := &validator{
+		layout:    wh,
+		cycle:     cycle,
+		forklifts: make(map[string]Position),
+		carried:   make(map[string]Package),
+		floor:     make(map[Position]Package),
+		racks:     make(map[string][]Package),
+		staged:    make(map[string][]Package),
+		cargo:     make(map[string][]Package),
+		delivered: make(map[string]int),
+		loads:     make(map[string]Weight),
+		gone:      make(map[string]bool),
+	}
+
+	for pos, forklift := range wh.ForkLifts {
+		v.forklifts[forklift.Name] = pos
+		if pack, carrying := forklift.Carrying(); carrying {
+			v.carried[forklift.Name] = pack
+		}
+	}
+	for pos, pack := range wh.Packages {
+		v.floor[pos] = pack
+	}
+	for _, rack := range wh.Racks {
+		v.racks[rack.Name] = append([]Package(nil), rack.Stack...)
+	}
+	for _, order := range wh.Orders {
+		v.staged[order.Name] = append([]Package(nil), order.Staged...)
+	}
+	for _, truck := range wh.Trucks {
+		v.cargo[truck.Name] = append([]Package(nil), truck.Cargo...)
+		v.loads[truck.Name] = truck.CurrentWeight
+		v.gone[truck.Name] = truck.TimeUntilReturn != 0
+	}
+	v.initial = v.packageCount()
+	return v
+}
+
+func (v *validator) report(format string, args ...any) {
+	v.violations = append(v.violations, violation{cycle: v.cycle, message: fmt.Sprintf(format, args...)})
+}
+
+// check checks the Event of the next cycle, returning the rules they break
+func (v *validator) check(events []Event) []violation {
+	v.cycle++
+	reported := len(v.violations)
+	acted := make(map[string]bool)
+	moves := make(map[Position]Position)
+
+	for _, event := range events {
+		switch event.(type) {
+		case TruckWait, TruckGone, OrderComplete:
+		default:
+			// A ForkLift does a single thing every cycle, where it stands
+			name := event.EmitterName()
+			pos, exists := v.forklifts[name]
+			if !exists {
+				v.report("unknown forklift %s", name)
+				continue
+			}
+			if acted[name] {
+				v.report("forklift %s acts twice", name)
+			}
+			acted[name] = true
+			if pos != event.AtPosition() {
+				v.report("forklift %s is at %s, not at %s", name, formatPosition(pos), formatPosition(event.AtPosition()))
+				v.forklifts[name] = event.AtPosition()
+			}
+		}
+
+		switch event := event.(type) {
+		case ForkliftMove:
+			v.move(event, moves)
+		case PickupPackage:
+			v.pickup(event)
+		case UnloadPackage:
+			v.unload(event)
+		case DeliverPackage:
+			v.deliver(event)
+		case StorePackage:
+			v.store(event)
+		case StagePackage:
+			v.stage(event)
+		case OrderComplete:
+			v.completeOrder(event)
+		case TruckWait:
+			v.truck(event.EmitterName(), event.AtPosition(), false, event.ChargedWeight(), event.MaxWeight())
+		case TruckGone:
+			v.truck(event.EmitterName(), event.AtPosition(), true, event.ChargedWeight(), event.MaxWeight())
+		}
+	}
+
+	for _, name := range sortedKeys(v.forklifts) {
+		if !acted[name] {
+			v.report("forklift %s does nothing", name)
+		}
+	}
+	v.checkConservation()
+	return v.violations[reported:]
+}
+
+func (v *validator) move(event ForkliftMove, moves map[Position]Position) {
+	name, from, to := event.EmitterName(), event.AtPosition(), event.ToPosition()
+
+	if exits, isStep := v.step(from, to); !isStep {
+		v.report("forklift %s moves from %s to %s, which aren't neighbours", name, formatPosition(from), formatPosition(to))
+	} else if !v.layout.ExitsAt(from).Has(exits) {
+		v.report("forklift %s leaves %s against its lane", name, formatPosition(from))
+	} else if v.cutsCorner(from, to) {
+		v.report("forklift %s cuts the corner of an obstacle moving from %s to %s", name, formatPosition(from),
+			formatPosition(to))
+	}
+	if v.isObstacle(to) {
+		v.report("forklift %s moves into the obstacle at %s", name, formatPosition(to))
+	}
+	for other, pos := range v.forklifts {
+		if other != name && pos == to {
+			v.report("forklift %s collides with %s at %s", name, other, formatPosition(to))
+		}
+	}
+	if back, moved := moves[to]; moved && back == from {
+		v.report("forklift %s swaps its tile with the forklift coming from %s", name, formatPosition(to))
+	}
+	if lift, isLift := v.layout.LiftAt(to); isLift && (from.X != to.X || from.Y != to.Y) {
+		inLift := 0
+		for _, pos := range v.forklifts {
+			if pos.X == lift.X && pos.Y == lift.Y && lift.Serves(pos.Floor) {
+				inLift++
+			}
+		}
+		if inLift >= lift.Capacity {
+			v.report("forklift %s gets in the full lift %s", name, lift.Name)
+		}
+	}
+
+	moves[from] = to
+	v.forklifts[name] = to
+}
+
+func (v *validator) pickup(event PickupPackage) {
+	name, source := event.EmitterName(), event.FromPosition()
+	v.checkEmptyHanded(name)
+	if _, isStep := v.step(event.AtPosition(), source); !isStep {
+		v.report("forklift %s takes the package %s at %s, which isn't next to it", name, event.PackageName(),
+			formatPosition(source))
+	}
+
+	pack := Package{Name: event.PackageName(), Weight: event.PackageWeight()}
+	if carried, carrying := v.carried[name]; carrying && carried.Name == pack.Name {
+		// Taken twice, the Package carried is kept
+		pack = carried
+	}
+	if rack, isRack := v.layout.Racks[source]; isRack {
+		stack := v.racks[rack.Name]
+		if len(stack) == 0 || stack[len(stack)-1].Name != pack.Name {
+			v.report("forklift %s takes the package %s, which isn't on top of the rack %s", name, pack.Name, rack.Name)
+		} else {
+			pack, v.racks[rack.Name] = stack[len(stack)-1], stack[:len(stack)-1]
+		}
+	} else if staging := v.layout.StagingAt(source); staging != -1 {
+		order := v.layout.Orders[staging].Name
+		index := indexOf(v.staged[order], pack.Name)
+		if index == -1 {
+			v.report("forklift %s takes the package %s, which isn't staged for the order %s", name, pack.Name, order)
+		} else {
+			pack = v.staged[order][index]
+			v.staged[order] = append(v.staged[order][:index], v.staged[order][index+1:]...)
+		}
+	} else if lying, exists := v.floor[source]; !exists || lying.Name != pack.Name {
+		v.report("forklift %s takes the package %s, which isn't at %s", name, pack.Name, formatPosition(source))
+	} else {
+		pack = lying
+		delete(v.floor, source)
+	}
+	v.carried[name] = pack
+}
+
+func (v *validator) unload(event UnloadPackage) {
+	name, truck := event.EmitterName(), event.TruckName()
+	v.checkEmptyHanded(name)
+	v.checkTruckReached(name, truck, event.AtPosition())
+
+	pack := Package{Name: event.PackageName(), Weight: event.PackageWeight()}
+	if index := indexOf(v.cargo[truck], pack.Name); index == -1 {
+		v.report("forklift %s unloads the package %s, which isn't in the truck %s", name, pack.Name, truck)
+	} else {
+		pack = v.cargo[truck][index]
+		v.cargo[truck] = append(v.cargo[truck][:index], v.cargo[truck][index+1:]...)
+	}
+	v.loads[truck] -= pack.Weight
+	v.carried[name] = pack
+}
+
+func (v *validator) deliver(event DeliverPackage) {
+	name, truckName := event.EmitterName(), event.TruckName()
+	pack := v.checkCarried(name, event.PackageName(), event.PackageWeight())
+	truck := v.checkTruckReached(name, truckName, event.AtPosition())
+
+	if v.loads[truckName]+pack.Weight > truck.MaxWeight {
+		v.report("forklift %s overloads the truck %s with the package %s, %d/%d", name, truckName, pack.Name,
+			v.loads[truckName]+pack.Weight, truck.MaxWeight)
+	}
+	if index := v.layout.OrderOf(pack); index != -1 && v.layout.Orders[index].Truck != truckName {
+		v.report("forklift %s loads the package %s of the order %s in the truck %s instead of %s", name, pack.Name,
+			pack.Order, truckName, v.layout.Orders[index].Truck)
+	}
+	v.loads[truckName] += pack.Weight
+	v.delivered[pack.Name]++
+	delete(v.carried, name)
+}
+
+func (v *validator) store(event StorePackage) {
+	name, rackName := event.EmitterName(), event.RackName()
+	pack := v.checkCarried(name, event.PackageName(), event.PackageWeight())
+
+	for pos, rack := range v.layout.Racks {
+		if rack.Name != rackName {
+			continue
+		}
+		if _, isStep := v.step(event.AtPosition(), pos); !isStep {
+			v.report("forklift %s stores the package %s in the rack %s, which isn't next to it", name, pack.Name, rackName)
+		}
+		if len(v.racks[rackName]) >= rack.Slots {
+			v.report("forklift %s stores the package %s in the full rack %s", name, pack.Name, rackName)
+		}
+	}
+	if _, exists := v.racks[rackName]; !exists {
+		v.report("forklift %s stores the package %s in the unknown rack %s", name, pack.Name, rackName)
+	}
+	v.racks[rackName] = append(v.racks[rackName], pack)
+	delete(v.carried, name)
+}
+
+func (v *validator) stage(event StagePackage) {
+	name, orderName := event.EmitterName(), event.OrderName()
+	pack := v.checkCarried(name, event.PackageName(), event.PackageWeight())
+
+	found := false
+	for _, order := range v.layout.Orders {
+		if order.Name != orderName {
+			continue
+		}
+		found = true
+		if _, isStep := v.step(event.AtPosition(), order.Staging); !isStep {
+			v.report("forklift %s stages the package %s away from the staging tile of the order %s", name, pack.Name,
+				orderName)
+		}
+		if pack.Order != orderName {
+			v.report("forklift %s stages the package %s for the order %s it doesn't belong to", name, pack.Name,
+				orderName)
+		}
+	}
+	if !found {
+		v.report("forklift %s stages the package %s for the unknown order %s", name, pack.Name, orderName)
+	}
+	v.staged[orderName] = append(v.staged[orderName], pack)
+	delete(v.carried, name)
+}
+
+func (v *validator) completeOrder(event OrderComplete) {
+	for _, order := range v.layout.Orders {
+		if order.Name != event.OrderName() {
+			continue
+		}
+		for _, pack := range order.Packages {
+			if v.delivered[pack] == 0 {
+				v.report("the order %s is told complete, its package %s isn't loaded", order.Name, pack)
+			}
+		}
+		return
+	}
+	v.report("the unknown order %s is told complete", event.OrderName())
+}
+
+// truck checks the state of a Truck told at the end of a cycle, a Truck coming back empty
+func (v *validator) truck(name string, pos Position, gone bool, chargedWeight Weight, maxWeight Weight) {
+	truck, exists := v.layout.Trucks[pos]
+	if !exists || truck.Name != name {
+		v.report("no truck %s at %s", name, formatPosition(pos))
+		return
+	}
+	if maxWeight != truck.MaxWeight {
+		v.report("the truck %s is told to carry %d instead of %d", name, maxWeight, truck.MaxWeight)
+	}
+	if !gone && chargedWeight == 0 {
+		// Back from being discharged
+		v.loads[name] = 0
+	}
+	if chargedWeight != v.loads[name] {
+		v.report("the truck %s is told loaded with %d instead of %d", name, chargedWeight, v.loads[name])
+		v.loads[name] = chargedWeight
+	}
+	if chargedWeight > truck.MaxWeight {
+		v.report("the truck %s is overloaded, %d/%d", name, chargedWeight, truck.MaxWeight)
+	}
+	v.gone[name] = gone
+}
+
+// checkConservation checks that every Package is still somewhere, once, reporting a change only once
+func (v *validator) checkConservation() {
+	count := v.packageCount()
+	var problems []string
+
+	for _, name := range sortedKeys(mergeKeys(v.initial, count)) {
+		switch {
+		case count[name] < v.initial[name]:
+			problems = append(problems, fmt.Sprintf("the package %s is lost", name))
+		case count[name] > v.initial[name]:
+			problems = append(problems, fmt.Sprintf("the package %s appears from nowhere", name))
+		}
+	}
+	unbalanced := strings.Join(problems, ", ")
+	if unbalanced != "" && unbalanced != v.unbalanced {
+		v.report("%s", unbalanced)
+	}
+	v.unbalanced = unbalanced
+}
+
+// packageCount counts the Package with every name, wherever they are
+func (v *validator) packageCount() map[string]int {
+	count := make(map[string]int)
+
+	for _, pack := range v.floor {
+		count[pack.Name]++
+	}
+	for _, pack := range v.carried {
+		count[pack.Name]++
+	}
+	for _, packages := range []map[string][]Package{v.racks, v.staged, v.cargo} {
+		for _, stack := range packages {
+			for _, pack := range stack {
+				count[pack.Name]++
+			}
+		}
+	}
+	for name, delivered := range v.delivered {
+		count[name] += delivered
+	}
+	return count
+}
+
+func (v *validator) checkEmptyHanded(name string) {
+	if pack, carrying := v.carried[name]; carrying {
+		v.report("forklift %s takes a package while carrying %s", name, pack.Name)
+	}
+}
+
+// checkCarried checks that a ForkLift carries a Package, returning it
+func (v *validator) checkCarried(name string, packName string, weight Weight) Package {
+	pack, carrying := v.carried[name]
+	if !carrying || pack.Name != packName {
+		v.report("forklift %s doesn't carry the package %s", name, packName)
+		return Package{Name: packName, Weight: weight}
+	}
+	if pack.Weight != weight {
+		v.report("the package %s is told to weigh %d instead of %d", packName, weight, pack.Weight)
+	}
+	return pack
+}
+
+// checkTruckReached checks that a Truck is at its dock, next to the ForkLift, returning it
+func (v *validator) checkTruckReached(name string, truckName string, pos Position) Truck {
+	truckPos, exists := v.layout.TruckPosition(truckName)
+	if !exists {
+		v.report("forklift %s reaches the unknown truck %s", name, truckName)
+		return Truck{Name: truckName}
+	}
+	if _, isStep := v.step(pos, truckPos); !isStep {
+		v.report("forklift %s reaches the truck %s, which isn't next to it", name, truckName)
+	}
+	if v.gone[truckName] {
+		v.report("forklift %s reaches the truck %s, which is gone", name, truckName)
+	}
+	return v.layout.Trucks[truckPos]
+}
+
+// isObstacle checks if a ForkLift can't stand on a tile
+func (v *validator) isObstacle(pos Position) bool {
+	wh := v.layout
+	_, isPackage := v.floor[pos]
+	return pos.X < 0 || pos.X >= wh.Length || pos.Y < 0 || pos.Y >= wh.Height || pos.Floor < 0 ||
+		pos.Floor >= wh.FloorCount() || wh.Walls[pos] || isPackage || wh.Trucks.Exists(pos) || wh.Racks.Exists(pos) ||
+		wh.StagingAt(pos) != -1
+}
+
+// step checks if a tile is a neighbour of another one, returning the Exits it's reached through, none for a Lift
+func (v *validator) step(from Position, to Position) (Exits, bool) {
+	if from.X == to.X && from.Y == to.Y {
+		fromLift, inLift := v.layout.LiftAt(from)
+		toLift, _ := v.layout.LiftAt(to)
+		return 0, inLift && fromLift == toLift && (to.Floor-from.Floor == 1 || from.Floor-to.Floor == 1)
+	}
+	dx, dy := to.X-from.X, to.Y-from.Y
+	if from.Floor != to.Floor || dx < -1 || dx > 1 || dy < -1 || dy > 1 {
+		return 0, false
+	}
+
+	switch v.layout.Neighbourhood {
+	case FourConnected:
+		if dx != 0 && dy != 0 {
+			return 0, false
+		}
+	case Hexagonal:
+		if dy != 0 {
+			// The rows above and below are reached to the left or to the right depending on the shift of the row
+			shift := v.layout.RowShift(from.Y)
+			if dx != shift-1 && dx != shift {
+				return 0, false
+			}
+			dx = 2*(dx-shift) + 1
+		}
+	}
+	return exitsToward[dy+1][dx+1], true
+}
+
+// exitsToward the Exits leaving a tile toward a neighbour, by vertical then horizontal offset
+var exitsToward = [3][3]Exits{
+	{ExitUpLeft, ExitUp, ExitUpRight},
+	{ExitLeft, 0, ExitRight},
+	{ExitDownLeft, ExitDown, ExitDownRight},
+}
+
+// cutsCorner checks if a diagonal move goes past an obstacle standing on one of its sides
+func (v *validator) cutsCorner(from Position, to Position) bool {
+	if v.layout.Neighbourhood != EightConnected || from.X == to.X || from.Y == to.Y || from.Floor != to.Floor {
+		return false
+	}
+	return v.isObstacle(Position{X: to.X, Y: from.Y, Floor: from.Floor}) ||
+		v.isObstacle(Position{X: from.X, Y: to.Y, Floor: from.Floor})
+}
+
+func indexOf(packages []Package, name string) int {
+	for index, pack := range packages {
+		if pack.Name == name {
+			return index
+		}
+	}
+	return -1
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mergeKeys(lhs map[string]int, rhs map[string]int) map[string]int {
+	merged := make(map[string]int, len(lhs))
+	for key := range lhs {
+		merged[key] = 0
+	}
+	for key := range rhs {
+		merged[key] = 0
+	}
+	return merged
+}
+
+// formatPosition formats a Position the way the prose does, with its floor
+func formatPosition(pos Position) string {
+	return fmt.Sprintf("[%d,%d,%d]", pos.X, pos.Y, pos.Floor)
+}
+
+// validate runs the validate subcommand, checking an event log against its scenario
+func validate(arguments []string) error {
+	if len(arguments) != 2 {
+		return errors.New("validate expects a scenario and an event log: gotrans validate <file> <events>")
+	}
+	scenario, err := os.Open(arguments[0])
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(scenario)
+	warehouse, _, err := parseScenarioFile(scenario)
+	if err != nil {
+		return err
+	}
+	events, err := os.Open(arguments[1])
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(events)
+
+	v := newValidator(warehouse, 0)
+	if err = validateEventLog(events, v); err != nil {
+		return err
+	}
+	for _, violation := range v.violations {
+		fmt.Println(violation)
+	}
+	if len(v.violations) != 0 {
+		return fmt.Errorf("%d rules broken over %d cycles", len(v.violations), v.cycle)
+	}
+	fmt.Printf("%d cycles follow every rule\n", v.cycle)
+	return nil
+}
+
+// validateEventLog reads the event log cycle by cycle, checking every cycle, the ones without any Event included
+func validateEventLog(file io.Reader, v *validator) error {
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	var events []Event
+
+	for {
+		var jsonEvent jsonEvent
+		if err := decoder.Decode(&jsonEvent); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid event log: %w", err)
+		}
+		if jsonEvent.Cycle <= v.cycle {
+			return fmt.Errorf("invalid event log: cycle %d comes after cycle %d", jsonEvent.Cycle, v.cycle+1)
+		}
+		for v.cycle+1 < jsonEvent.Cycle {
+			v.check(events)
+			events = nil
+		}
+
+		event, err := jsonEvent.event()
+		if err != nil {
+			return fmt.Errorf("invalid event log: cycle %d: %w", jsonEvent.Cycle, err)
+		}
+		events = append(events, event)
+	}
+	if events != nil {
+		v.check(events)
+	}
+	return nil
+}
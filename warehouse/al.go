@@ -2,8 +2,10 @@
 package warehouse
 
 import (
+	"container/heap"
 	"fmt"
 	"os"
+	"sort"
 )
 
 const (
@@ -12,26 +14,45 @@ const (
 	rIGHT
 	dOWN
 	lEFT
+	uPRIGHT
+	dOWNRIGHT
+	dOWNLEFT
+	uPLEFT
+	uPSTAIRS
+	dOWNSTAIRS
 )
 
-// Path represent a ForkLift's Path with its current Position its target and all the steps
+// Path represent a ForkLift's Path with its current Position its target and all the steps,
+// a step is repeated for every extra cycle needed to cross its tile,
+// retrieval is the cycles left before getting the Package once the ForkLift is by a Rack
 type Path struct {
 	current     Position
 	destination Position
 	steps       []Position
+	retrieval   int
 }
 
 type direction = int
 
-func refreshPaths(wh Warehouse, currentPaths []Path) []Path {
+// refreshPaths plans the Path of every ForkLift without any, finding them with a pathFinder
+func refreshPaths(wh Warehouse, currentPaths []Path, findPath pathFinder) []Path {
 	targetedPackages := countTargetedPackages(wh, currentPaths)
 	idle := getIdleForklifts(wh.ForkLifts, currentPaths, true)
 	trucks := mapToPositionSet(wh.Trucks)
-	for pos := range idle {
+	for _, pos := range SortedPositions(idle) {
 		truckValidator := func(_ []attemptPosition, targetPos Position) bool {
 			return wh.Trucks[targetPos].MaxWeight >= wh.ForkLifts[pos].pack.Weight
 		}
-		path := pathToObject(wh, pos, trucks, currentPaths, truckValidator)
+		var path Path
+
+		if wh.Mission == PutAway {
+			path = pathToStorage(wh, pos, currentPaths, findPath)
+		} else if order := wh.OrderOf(*wh.ForkLifts[pos].pack); order != -1 {
+			orderValidator := func(_ []attemptPosition, _ Position) bool { return true }
+			path = findPath(wh, pos, wh.orderDestinations(wh.Orders[order]), currentPaths, orderValidator)
+		} else {
+			path = findPath(wh, pos, trucks, currentPaths, truckValidator)
+		}
 
 		if path.isValid() {
 			currentPaths = append(currentPaths, path)
@@ -39,15 +60,16 @@ func refreshPaths(wh Warehouse, currentPaths []Path) []Path {
 	}
 
 	idle = getIdleForklifts(wh.ForkLifts, currentPaths, false)
-	packages := mapToPositionSet(wh.Packages)
+	packages := getPackagesPositions(wh)
+	pickupSpots := len(packages)
 
-	for len(idle) > 0 && targetedPackages < len(wh.Packages) {
-		pos := idle.randomElem()
+	for len(idle) > 0 && targetedPackages < pickupSpots {
+		pos := idle.firstElem()
 		packageValidator := func(path []attemptPosition, pos Position) bool {
 			return shouldGoToPackage(wh, path, pos, currentPaths)
 		}
 
-		path := pathToObject(wh, pos, packages, currentPaths, packageValidator)
+		path := findPath(wh, pos, packages, currentPaths, packageValidator)
 		replaced := false
 
 		if path.isValid() {
@@ -66,24 +88,26 @@ func refreshPaths(wh Warehouse, currentPaths []Path) []Path {
 	return currentPaths
 }
 
+// pathToObject explores the paths depth first, toward the nearest target first, giving up a path as soon as it
+// costs as much as the best one found
 func pathToObject(wh Warehouse, start Position, targets positionSet, otherPaths []Path, validator validator) Path {
 	bestPath := Path{current: start, destination: start}
-	nearestTarget := getNearestEntityPos(start, targets)
+	nearestTarget := getNearestEntityPos(wh, start, targets)
 	currentPath := []attemptPosition{{
 		Position:   start,
-		directions: getDirectionsPriority(start, nearestTarget, nONE), nextDirection: 0,
+		directions: getDirectionsPriority(wh, start, nearestTarget, nONE), nextDirection: 0,
 	}}
 	posSet := make(map[Position]struct{})
 
 	for len(currentPath) > 0 {
 		currentStep := &currentPath[len(currentPath)-1]
 
-		for currentStep.nextDirection < 4 &&
+		for currentStep.nextDirection < len(currentStep.directions) &&
 			currentStep.directions[currentStep.nextDirection] == nONE {
 			currentStep.nextDirection++
 		}
 
-		if currentStep.nextDirection < 4 && shouldKeepSearching(currentPath, bestPath) {
+		if currentStep.nextDirection < len(currentStep.directions) && shouldKeepSearching(currentPath, bestPath) {
 			nextMove := currentStep.directions[currentStep.nextDirection]
 			move(wh, currentStep.Position, nextMove, &currentPath, posSet, &bestPath,
 				otherPaths, validator, targets)
@@ -97,33 +121,203 @@ func pathToObject(wh Warehouse, start Position, targets positionSet, otherPaths
 	return bestPath
 }
 
+// shortestPathToObject settles the tiles from the cheapest to reach, so that the first target accepted by the
+// validator is reached by the cheapest path there is
+func shortestPathToObject(wh Warehouse, start Position, targets positionSet, otherPaths []Path, validator validator) Path {
+	costs := map[Position]int{start: 0}
+	previous := make(map[Position]Position)
+	frontier := &tileQueue{{Position: start}}
+
+	for frontier.Len() > 0 {
+		current := heap.Pop(frontier).(attemptPosition)
+		if current.cost > costs[current.Position] {
+			continue
+		}
+
+		directions := neighbourDirections(wh.Neighbourhood)
+		if _, isLift := wh.LiftAt(current.Position); isLift {
+			directions = append(directions, uPSTAIRS, dOWNSTAIRS)
+		}
+		for _, dir := range directions {
+			newPos, possible := getNewPos(wh, current.Position, dir)
+			if !possible || cutsCorner(wh, current.Position, dir) ||
+				isSomeoneOnThisTile(newPos, otherPaths, current.cost, crossingCost(wh, current.Position, newPos)) {
+				continue
+			}
+
+			if targets.has(newPos) {
+				attempt := attemptTo(current.Position, previous, costs)
+				if validator(attempt, newPos) {
+					return attemptToPath(attempt, newPos)
+				}
+				continue
+			}
+			if wh.SomethingExistsAt(newPos) || !wh.ExitsAt(current.Position).Has(exitOf(dir)) {
+				continue
+			}
+
+			cost := current.cost + crossingCost(wh, current.Position, newPos)
+			if known, reached := costs[newPos]; reached && known <= cost {
+				continue
+			}
+			costs[newPos], previous[newPos] = cost, current.Position
+			heap.Push(frontier, attemptPosition{Position: newPos, cost: cost})
+		}
+	}
+
+	return Path{current: start, destination: start}
+}
+
+// attemptTo rebuilds the attemptPosition leading from the start of a search to a tile
+func attemptTo(pos Position, previous map[Position]Position, costs map[Position]int) []attemptPosition {
+	attempt := []attemptPosition{{Position: pos, cost: costs[pos]}}
+
+	for from, exists := previous[pos]; exists; from, exists = previous[from] {
+		attempt = append([]attemptPosition{{Position: from, cost: costs[from]}}, attempt...)
+	}
+
+	return attempt
+}
+
+// pathToStorage finds the path to the Rack chosen by the SlottingRule of the Warehouse,
+// the nearest Rack with a free slot is chosen when the preferred ones can't be reached
+func pathToStorage(wh Warehouse, start Position, otherPaths []Path, findPath pathFinder) Path {
+	freeSlots := getFreeSlots(wh, otherPaths)
+	anyRack := func(_ []attemptPosition, _ Position) bool { return true }
+
+	if wh.Slotting == LowestSlot {
+		lowest := make(positionSet)
+		lowestLevel := -1
+
+		for pos := range freeSlots {
+			level := wh.Racks[pos].Slots - freeSlots[pos]
+			if lowestLevel == -1 || level < lowestLevel {
+				lowest, lowestLevel = make(positionSet), level
+			}
+			if level == lowestLevel {
+				lowest[pos] = struct{}{}
+			}
+		}
+
+		if path := findPath(wh, start, lowest, otherPaths, anyRack); path.isValid() {
+			return path
+		}
+	}
+
+	return findPath(wh, start, mapToPositionSet(freeSlots), otherPaths, anyRack)
+}
+
+// getFreeSlots returns the number of slots of every Rack that are neither filled nor promised to a ForkLift
+func getFreeSlots(wh Warehouse, paths []Path) map[Position]int {
+	freeSlots := make(map[Position]int)
+
+	for pos, rack := range wh.Racks {
+		freeSlots[pos] = rack.Slots - len(rack.Stack)
+	}
+	for _, path := range paths {
+		if _, isRack := freeSlots[path.destination]; isRack && wh.ForkLifts[path.current].pack != nil {
+			freeSlots[path.destination]--
+		}
+	}
+	for pos, free := range freeSlots {
+		if free <= 0 {
+			delete(freeSlots, pos)
+		}
+	}
+
+	return freeSlots
+}
+
 func move(wh Warehouse, currentPos Position, direction int, path *[]attemptPosition,
 	posSet positionSet, currentBest *Path, otherPaths []Path, validator validator, targets positionSet,
 ) {
-	newPos, possible := getNewPos(currentPos, direction, wh.Length, wh.Height)
+	newPos, possible := getNewPos(wh, currentPos, direction)
+	if !possible {
+		return
+	}
+	cost := crossingCost(wh, currentPos, newPos)
 
-	if !possible || alreadyVisited(posSet, newPos) ||
-		isSomeoneOnThisTile(newPos, otherPaths, len(*path)-1) {
+	if alreadyVisited(posSet, newPos) || cutsCorner(wh, currentPos, direction) ||
+		isSomeoneOnThisTile(newPos, otherPaths, (*path)[len(*path)-1].cost, cost) {
 		return
 	}
 
 	if targets.has(newPos) {
+		// A reached target is kept as a cheaper path to it can still be found
 		if validator(*path, newPos) {
 			*currentBest = attemptToPath(*path, newPos)
+		} else {
+			delete(targets, newPos)
 		}
-		delete(targets, newPos)
-	} else if wh.SomethingExistsAt(newPos) {
+	} else if wh.SomethingExistsAt(newPos) || !wh.ExitsAt(currentPos).Has(exitOf(direction)) {
 		return
 	} else {
 		*path = append(*path, attemptPosition{
-			directions: getDirectionsPriority(newPos, getNearestEntityPos(newPos, targets), inverseDirection(direction)),
+			directions: getDirectionsPriority(wh, newPos, getNearestEntityPos(wh, newPos, targets), inverseDirection(direction)),
 			Position:   newPos,
+			cost:       (*path)[len(*path)-1].cost + cost,
 		})
 		posSet[newPos] = struct{}{}
 	}
 }
 
-func getDirectionsPriority(current Position, target Position,
+func getDirectionsPriority(wh Warehouse, current Position, target Position,
+	comingFrom direction,
+) [10]direction {
+	var positions [10]direction
+	directions := make([]direction, 0, len(positions))
+
+	if wh.Neighbourhood == FourConnected {
+		cardinals := getCardinalDirectionsPriority(current, target, comingFrom)
+		directions = append(directions, cardinals[:]...)
+	} else {
+		for _, dir := range neighbourDirections(wh.Neighbourhood) {
+			if dir != comingFrom {
+				directions = append(directions, dir)
+			}
+		}
+
+		sort.SliceStable(directions, func(lhs, rhs int) bool {
+			lhsPos, _ := getNewPos(wh, current, directions[lhs])
+			rhsPos, _ := getNewPos(wh, current, directions[rhs])
+			return distance(wh.Neighbourhood, lhsPos, target) < distance(wh.Neighbourhood, rhsPos, target)
+		})
+	}
+
+	copy(positions[:], addFloorDirections(wh, directions, current, target, comingFrom))
+
+	return positions
+}
+
+// addFloorDirections adds the directions to the other floors when standing in a Lift,
+// the one leading to the floor of the target comes first
+func addFloorDirections(wh Warehouse, directions []direction, current Position, target Position,
+	comingFrom direction,
+) []direction {
+	if _, isLift := wh.LiftAt(current); !isLift {
+		return directions
+	}
+
+	toward, away := direction(uPSTAIRS), direction(dOWNSTAIRS)
+	if target.Floor < current.Floor {
+		toward, away = away, toward
+	}
+
+	if toward != comingFrom {
+		if target.Floor != current.Floor {
+			directions = append([]direction{toward}, directions...)
+		} else {
+			directions = append(directions, toward)
+		}
+	}
+	if away != comingFrom {
+		directions = append(directions, away)
+	}
+
+	return directions
+}
+
+func getCardinalDirectionsPriority(current Position, target Position,
 	comingFrom direction,
 ) [4]direction {
 	distanceX := target.X - current.X
@@ -158,31 +352,86 @@ func getDirectionsPriority(current Position, target Position,
 	return positions
 }
 
-func getNewPos(pos Position, direction int, sizeX int, sizeY int) (Position, bool) {
+func getNewPos(wh Warehouse, pos Position, direction direction) (Position, bool) {
+	delta := directionDelta(direction)
+
+	// The diagonal toward the shift of the row reaches the hexagon straight above or below
+	if wh.Neighbourhood == Hexagonal && delta.Y != 0 && delta.X != 0 && (delta.X > 0) == (wh.RowShift(pos.Y) == 0) {
+		delta.X = 0
+	}
+
+	pos.X += delta.X
+	pos.Y += delta.Y
+
+	if delta.Floor != 0 {
+		lift, isLift := wh.LiftAt(pos)
+		pos.Floor += delta.Floor
+
+		return pos, isLift && lift.Serves(pos.Floor)
+	}
+
+	return pos, wh.isInside(pos)
+}
+
+func directionDelta(direction direction) Position {
 	switch direction {
 	case uP:
-		pos.Y--
+		return Position{X: 0, Y: -1}
+	case rIGHT:
+		return Position{X: 1, Y: 0}
 	case dOWN:
-		pos.Y++
+		return Position{X: 0, Y: 1}
 	case lEFT:
-		pos.X--
-	case rIGHT:
-		pos.X++
+		return Position{X: -1, Y: 0}
+	case uPRIGHT:
+		return Position{X: 1, Y: -1}
+	case dOWNRIGHT:
+		return Position{X: 1, Y: 1}
+	case dOWNLEFT:
+		return Position{X: -1, Y: 1}
+	case uPLEFT:
+		return Position{X: -1, Y: -1}
+	case uPSTAIRS:
+		return Position{Floor: 1}
+	case dOWNSTAIRS:
+		return Position{Floor: -1}
+	default:
+		return Position{}
 	}
+}
 
-	valid := pos.X >= 0 && pos.X < sizeX && pos.Y >= 0 && pos.Y < sizeY
+func neighbourDirections(neighbourhood Neighbourhood) []direction {
+	switch neighbourhood {
+	case EightConnected:
+		return []direction{uP, uPRIGHT, rIGHT, dOWNRIGHT, dOWN, dOWNLEFT, lEFT, uPLEFT}
+	case Hexagonal:
+		return []direction{uPRIGHT, rIGHT, dOWNRIGHT, dOWNLEFT, lEFT, uPLEFT}
+	default:
+		return []direction{uP, rIGHT, dOWN, lEFT}
+	}
+}
+
+// cutsCorner checks if a diagonal move would go past an obstacle standing on one of its sides
+func cutsCorner(wh Warehouse, pos Position, direction direction) bool {
+	delta := directionDelta(direction)
+
+	if wh.Neighbourhood != EightConnected || delta.X == 0 || delta.Y == 0 {
+		return false
+	}
 
-	return pos, valid
+	return wh.isObstacle(Position{X: pos.X + delta.X, Y: pos.Y}) ||
+		wh.isObstacle(Position{X: pos.X, Y: pos.Y + delta.Y})
 }
 
-func getNearestEntityPos(pos Position, entitiesPos positionSet) Position {
-	nearest := entitiesPos.randomElem()
-	nearestDistance := euclideanDistance(pos, nearest)
+func getNearestEntityPos(wh Warehouse, pos Position, entitiesPos positionSet) Position {
+	nearest := entitiesPos.firstElem()
+	nearestDistance := distance(wh.Neighbourhood, pos, nearest)
 
 	for entityPos := range entitiesPos {
-		currentDistance := euclideanDistance(pos, entityPos)
+		currentDistance := distance(wh.Neighbourhood, pos, entityPos)
 
-		if currentDistance < nearestDistance {
+		// Ties are broken by the reading order for the cleaning to be deterministic
+		if currentDistance < nearestDistance || (currentDistance == nearestDistance && entityPos.before(nearest)) {
 			nearest = entityPos
 			nearestDistance = currentDistance
 		}
@@ -191,15 +440,38 @@ func getNearestEntityPos(pos Position, entitiesPos positionSet) Position {
 	return nearest
 }
 
+// distance the minimum number of moves between two Position in the given Neighbourhood
+func distance(neighbourhood Neighbourhood, lhs Position, rhs Position) int {
+	floors := abs(lhs.Floor - rhs.Floor)
+
+	switch neighbourhood {
+	case EightConnected:
+		if abs(lhs.X-rhs.X) > abs(lhs.Y-rhs.Y) {
+			return abs(lhs.X-rhs.X) + floors
+		}
+		return abs(lhs.Y-rhs.Y) + floors
+	case Hexagonal:
+		// Converts the offset coordinates to axial ones
+		lhsQ := lhs.X - (lhs.Y-lhs.Y%2)/2
+		rhsQ := rhs.X - (rhs.Y-rhs.Y%2)/2
+		distanceQ, distanceR := lhsQ-rhsQ, lhs.Y-rhs.Y
+		return (abs(distanceQ)+abs(distanceR)+abs(distanceQ+distanceR))/2 + floors
+	default:
+		return euclideanDistance(lhs, rhs)
+	}
+}
+
 func euclideanDistance(lhs Position, rhs Position) int {
-	return abs(lhs.X-rhs.X) + abs(lhs.Y-rhs.Y)
+	return abs(lhs.X-rhs.X) + abs(lhs.Y-rhs.Y) + abs(lhs.Floor-rhs.Floor)
 }
 
 func attemptToPath(attempt []attemptPosition, destination Position) Path {
 	path := Path{current: attempt[0].Position, destination: destination}
 
 	for pos := 1; pos < len(attempt); pos++ {
-		path.steps = append(path.steps, attempt[pos].Position)
+		for cycle := attempt[pos-1].cost; cycle < attempt[pos].cost; cycle++ {
+			path.steps = append(path.steps, attempt[pos].Position)
+		}
 	}
 
 	return path
@@ -215,41 +487,126 @@ func inverseDirection(direction int) int {
 		return rIGHT
 	case rIGHT:
 		return lEFT
+	case uPRIGHT:
+		return dOWNLEFT
+	case dOWNLEFT:
+		return uPRIGHT
+	case uPLEFT:
+		return dOWNRIGHT
+	case dOWNRIGHT:
+		return uPLEFT
+	case uPSTAIRS:
+		return dOWNSTAIRS
+	case dOWNSTAIRS:
+		return uPSTAIRS
 	default:
 		return 0
 	}
 }
 
+func exitOf(direction direction) Exits {
+	// Lifts can always be taken
+	if direction == nONE || direction > uPLEFT {
+		return 0
+	}
+	return Exits(1) << (direction - 1)
+}
+
+// laneExits the Exits of a lane tile, every direction going backward is forbidden
+func laneExits(forward direction) Exits {
+	flow := directionDelta(forward)
+	exits := AllExits
+
+	for dir := uP; dir <= uPLEFT; dir++ {
+		delta := directionDelta(dir)
+
+		if delta.X*flow.X+delta.Y*flow.Y < 0 {
+			exits &^= exitOf(dir)
+		}
+	}
+
+	return exits
+}
+
+func directionBetween(from Position, to Position) direction {
+	switch {
+	case to.Y < from.Y:
+		return uP
+	case to.Y > from.Y:
+		return dOWN
+	case to.X < from.X:
+		return lEFT
+	case to.X > from.X:
+		return rIGHT
+	default:
+		return nONE
+	}
+}
+
 func shouldGoToPackage(wh Warehouse, attempt []attemptPosition, pos Position, otherPaths []Path) bool {
-	if !wh.Packages.Exists(pos) {
+	if !wh.HasPackageAt(pos) {
 		return false
 	}
 
 	existing := getExistingPathTo(pos, otherPaths)
 
-	return !existing.isValid() || len(attempt) <= len(existing.steps)
+	return !existing.isValid() || attempt[len(attempt)-1].cost < len(existing.steps)
 }
 
 func shouldKeepSearching(attempt []attemptPosition, currentBest Path) bool {
-	return !currentBest.isValid() || len(attempt) <= len(currentBest.steps)
+	return !currentBest.isValid() || attempt[len(attempt)-1].cost < len(currentBest.steps)
 }
 
+// attemptPosition a Position of a Path being searched
+// cost the cycles needed to reach this Position from the start of the Path
 type attemptPosition struct {
 	Position
-	directions    [4]direction
+	directions    [10]direction
 	nextDirection int
+	cost          int
 }
 
 type positionSet map[Position]struct{}
 
+// tileQueue the tiles reached by a search, the cheapest one coming first, in reading order when they cost as much
+type tileQueue []attemptPosition
+
+func (queue tileQueue) Len() int { return len(queue) }
+
+func (queue tileQueue) Less(lhs, rhs int) bool {
+	if queue[lhs].cost != queue[rhs].cost {
+		return queue[lhs].cost < queue[rhs].cost
+	}
+	return queue[lhs].Position.before(queue[rhs].Position)
+}
+
+func (queue tileQueue) Swap(lhs, rhs int) { queue[lhs], queue[rhs] = queue[rhs], queue[lhs] }
+
+func (queue *tileQueue) Push(tile any) { *queue = append(*queue, tile.(attemptPosition)) }
+
+func (queue *tileQueue) Pop() any {
+	tile := (*queue)[len(*queue)-1]
+	*queue = (*queue)[:len(*queue)-1]
+	return tile
+}
+
 type validator = func([]attemptPosition, Position) bool
 
-func (set positionSet) randomElem() Position {
+// pathFinder finds the Path of a ForkLift from its Position to one of the targets accepted by the validator
+type pathFinder = func(wh Warehouse, start Position, targets positionSet, otherPaths []Path, validator validator) Path
+
+// firstElem returns the first Position of the set in reading order
+func (set positionSet) firstElem() Position {
+	var first Position
+	found := false
+
 	for pos := range set {
-		return pos
+		if !found || pos.before(first) {
+			first, found = pos, true
+		}
 	}
 
-	return Position{}
+	return first
 }
 
 func (set positionSet) has(pos Position) bool {
@@ -264,16 +621,29 @@ func alreadyVisited(set positionSet, pos Position) bool {
 	return has
 }
 
-func isSomeoneOnThisTile(pos Position, paths []Path, turn int) bool {
+// isSomeoneOnThisTile checks if another Path stands on a Position during any of the turns a ForkLift arriving at
+// a turn stays on it to cross it
+func isSomeoneOnThisTile(pos Position, paths []Path, arrival int, turns int) bool {
 	for _, path := range paths {
-		if len(path.steps) > turn && path.steps[turn] == pos {
-			return true
+		for turn := arrival; turn < arrival+turns && turn < len(path.steps); turn++ {
+			if path.steps[turn] == pos {
+				return true
+			}
 		}
 	}
 
 	return false
 }
 
+// crossingCost the cycles needed to enter a tile from a neighbour one, the transfer time of the Lift between floors
+func crossingCost(wh Warehouse, from Position, to Position) int {
+	if from.Floor != to.Floor {
+		lift, _ := wh.LiftAt(from)
+		return lift.TransferTime
+	}
+	return wh.CostAt(to)
+}
+
 func getExistingPathTo(pos Position, paths []Path) Path {
 	for _, path := range paths {
 		if pos == path.destination {
@@ -299,7 +669,7 @@ func countTargetedPackages(wh Warehouse, paths []Path) int {
 	packages := 0
 
 	for _, path := range paths {
-		if wh.Packages.Exists(path.destination) {
+		if wh.HasPackageAt(path.destination) {
 			packages++
 		}
 	}
@@ -323,7 +693,30 @@ func getIdleForklifts(forklifts EntityMap[ForkLift], paths []Path, loaded bool)
 	return idleSet
 }
 
-func mapToPositionSet[T Package | Truck | ForkLift](entities EntityMap[T]) positionSet {
+// getPackagesPositions returns every Position a Package can be picked up at
+func getPackagesPositions(wh Warehouse) positionSet {
+	set := mapToPositionSet(wh.Packages)
+
+	for pos := range wh.Racks {
+		if wh.HasPackageAt(pos) {
+			set[pos] = struct{}{}
+		}
+	}
+	for pos := range wh.Trucks {
+		if wh.HasPackageAt(pos) {
+			set[pos] = struct{}{}
+		}
+	}
+	for _, order := range wh.Orders {
+		if wh.HasPackageAt(order.Staging) {
+			set[order.Staging] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+func mapToPositionSet[T Package | Truck | ForkLift | Rack | int](entities map[Position]T) positionSet {
 	set := make(map[Position]struct{}, len(entities))
 
 	for pos := range entities {
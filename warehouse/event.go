@@ -9,10 +9,13 @@ type Event interface {
 }
 
 // PickupPackage pickup package event
+// source the Position the Package is taken from, on the floor, in a Rack or on a staging tile
 type PickupPackage struct {
 	position    Position
 	emitterName string
 	packName    string
+	packWeight  Weight
+	source      Position
 }
 
 func (pickPack PickupPackage) EmitterName() string {
@@ -27,12 +30,42 @@ func (pickPack PickupPackage) PackageName() string {
 	return pickPack.packName
 }
 
+func (pickPack PickupPackage) PackageWeight() Weight {
+	return pickPack.packWeight
+}
+
+func (pickPack PickupPackage) FromPosition() Position {
+	return pickPack.source
+}
+
 // ForkliftWait forklift wait event
 type ForkliftWait struct {
 	forkliftName string
 	position     Position
+	reason       WaitReason
 }
 
+// WaitReason why a ForkLift waits
+type WaitReason int
+
+// The WaitReason of a ForkLift
+// Idle nothing left to do or nowhere to go
+// Blocked the next tile is taken or the Lift is full
+// Crossing still crossing a costly tile or riding a Lift
+// Retrieving reaching the level of a Rack
+// FullTruck the Truck can't take the Package carried
+// FullRack the Rack has no free slot left
+// TargetGone the Package or the destination was taken by someone else
+const (
+	Idle WaitReason = iota
+	Blocked
+	Crossing
+	Retrieving
+	FullTruck
+	FullRack
+	TargetGone
+)
+
 func (fw ForkliftWait) EmitterName() string {
 	return fw.forkliftName
 }
@@ -41,6 +74,10 @@ func (fw ForkliftWait) AtPosition() Position {
 	return fw.position
 }
 
+func (fw ForkliftWait) Reason() WaitReason {
+	return fw.reason
+}
+
 // ForkliftMove forklift move event
 type ForkliftMove struct {
 	forkliftName  string
@@ -65,6 +102,8 @@ type DeliverPackage struct {
 	position    Position
 	emitterName string
 	packName    string
+	packWeight  Weight
+	truckName   string
 }
 
 func (d DeliverPackage) EmitterName() string {
@@ -79,6 +118,120 @@ func (d DeliverPackage) PackageName() string {
 	return d.packName
 }
 
+func (d DeliverPackage) PackageWeight() Weight {
+	return d.packWeight
+}
+
+func (d DeliverPackage) TruckName() string {
+	return d.truckName
+}
+
+// UnloadPackage unload package from a truck event
+type UnloadPackage struct {
+	position    Position
+	emitterName string
+	packName    string
+	packWeight  Weight
+	truckName   string
+}
+
+func (u UnloadPackage) EmitterName() string {
+	return u.emitterName
+}
+
+func (u UnloadPackage) AtPosition() Position {
+	return u.position
+}
+
+func (u UnloadPackage) PackageName() string {
+	return u.packName
+}
+
+func (u UnloadPackage) PackageWeight() Weight {
+	return u.packWeight
+}
+
+func (u UnloadPackage) TruckName() string {
+	return u.truckName
+}
+
+// StorePackage store package in a rack event
+type StorePackage struct {
+	position    Position
+	emitterName string
+	packName    string
+	packWeight  Weight
+	rackName    string
+}
+
+func (s StorePackage) EmitterName() string {
+	return s.emitterName
+}
+
+func (s StorePackage) AtPosition() Position {
+	return s.position
+}
+
+func (s StorePackage) PackageName() string {
+	return s.packName
+}
+
+func (s StorePackage) PackageWeight() Weight {
+	return s.packWeight
+}
+
+func (s StorePackage) RackName() string {
+	return s.rackName
+}
+
+// StagePackage drop package on the staging tile of its order event
+type StagePackage struct {
+	position    Position
+	emitterName string
+	packName    string
+	packWeight  Weight
+	orderName   string
+}
+
+func (s StagePackage) EmitterName() string {
+	return s.emitterName
+}
+
+func (s StagePackage) AtPosition() Position {
+	return s.position
+}
+
+func (s StagePackage) PackageName() string {
+	return s.packName
+}
+
+func (s StagePackage) PackageWeight() Weight {
+	return s.packWeight
+}
+
+func (s StagePackage) OrderName() string {
+	return s.orderName
+}
+
+// OrderComplete every package of an order loaded in its truck event
+type OrderComplete struct {
+	orderName string
+	truckName string
+	position  Position
+}
+
+func (o OrderComplete) EmitterName() string {
+	return o.truckName
+}
+
+func (o OrderComplete) AtPosition() Position {
+	return o.position
+}
+
+func (o OrderComplete) OrderName() string {
+	return o.orderName
+}
+
 // TruckWait truck wait event
 type TruckWait struct {
 	truckName         string
@@ -140,3 +293,74 @@ func createTruckGone(truck Truck, pos Position) TruckGone {
 		truckChargedWeight: truck.CurrentWeight, position: pos,
 	}
 }
+
+// NewForkliftWait creates the Event of a ForkLift waiting, to replay a recorded cleaning
+func NewForkliftWait(forkliftName string, pos Position, reason WaitReason) ForkliftWait {
+	return ForkliftWait{forkliftName: forkliftName, position: pos, reason: reason}
+}
+
+// NewForkliftMove creates the Event of a ForkLift moving to a neighbour tile, to replay a recorded cleaning
+func NewForkliftMove(forkliftName string, pos Position, target Position) ForkliftMove {
+	return ForkliftMove{forkliftName: forkliftName, eventPosition: pos, target: target}
+}
+
+// NewPickupPackage creates the Event of a ForkLift taking a Package, to replay a recorded cleaning
+func NewPickupPackage(forkliftName string, pos Position, pack Package, source Position) PickupPackage {
+	return PickupPackage{
+		position: pos, emitterName: forkliftName,
+		packName: pack.Name, packWeight: pack.Weight, source: source,
+	}
+}
+
+// NewDeliverPackage creates the Event of a ForkLift loading a Package in a Truck, to replay a recorded cleaning
+func NewDeliverPackage(forkliftName string, pos Position, pack Package, truckName string) DeliverPackage {
+	return DeliverPackage{
+		position: pos, emitterName: forkliftName,
+		packName: pack.Name, packWeight: pack.Weight, truckName: truckName,
+	}
+}
+
+// NewUnloadPackage creates the Event of a ForkLift unloading a Package from a Truck, to replay a recorded cleaning
+func NewUnloadPackage(forkliftName string, pos Position, pack Package, truckName string) UnloadPackage {
+	return UnloadPackage{
+		position: pos, emitterName: forkliftName,
+		packName: pack.Name, packWeight: pack.Weight, truckName: truckName,
+	}
+}
+
+// NewStorePackage creates the Event of a ForkLift storing a Package in a Rack, to replay a recorded cleaning
+func NewStorePackage(forkliftName string, pos Position, pack Package, rackName string) StorePackage {
+	return StorePackage{
+		position: pos, emitterName: forkliftName,
+		packName: pack.Name, packWeight: pack.Weight, rackName: rackName,
+	}
+}
+
+// NewStagePackage creates the Event of a ForkLift staging a Package for its Order, to replay a recorded cleaning
+func NewStagePackage(forkliftName string, pos Position, pack Package, orderName string) StagePackage {
+	return StagePackage{
+		position: pos, emitterName: forkliftName,
+		packName: pack.Name, packWeight: pack.Weight, orderName: orderName,
+	}
+}
+
+// NewOrderComplete creates the Event of a Truck loaded with a whole Order, to replay a recorded cleaning
+func NewOrderComplete(truckName string, pos Position, orderName string) OrderComplete {
+	return OrderComplete{orderName: orderName, truckName: truckName, position: pos}
+}
+
+// NewTruckWait creates the Event of a Truck waiting at its dock, to replay a recorded cleaning
+func NewTruckWait(truckName string, pos Position, chargedWeight Weight, maxWeight Weight) TruckWait {
+	return TruckWait{
+		truckName: truckName, truckMaxWeight: maxWeight,
+		truckLoadedWeight: chargedWeight, position: pos,
+	}
+}
+
+// NewTruckGone creates the Event of a Truck gone to be discharged, to replay a recorded cleaning
+func NewTruckGone(truckName string, pos Position, chargedWeight Weight, maxWeight Weight) TruckGone {
+	return TruckGone{
+		truckName: truckName, truckMaxWeight: maxWeight,
+		truckChargedWeight: chargedWeight, position: pos,
+	}
+}
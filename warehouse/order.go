@@ -0,0 +1,135 @@
+package warehouse
+
+// Order description of an Order, a set of Package gathered on a staging tile before being shipped together
+// Name name of the Order
+// Packages names of every Package of the Order
+// Staging Position of the staging tile the Package are gathered on
+// Truck name of the only Truck the Order can be shipped in
+// Weight Weight of the whole Order
+// Staged the Package lying on the staging tile
+// Consolidated whether every Package of the Order was gathered on the staging tile
+// Loaded Weight of the Order already loaded in its Truck
+type Order struct {
+	Name         string
+	Packages     []string
+	Staging      Position
+	Truck        string
+	Weight       Weight
+	Staged       []Package
+	Consolidated bool
+	Loaded       Weight
+}
+
+// IsComplete checks if the whole Order was loaded in its Truck
+func (order Order) IsComplete() bool {
+	return order.Consolidated && order.Loaded == order.Weight
+}
+
+// isLoading checks if the Order is partially loaded in its Truck
+func (order Order) isLoading() bool {
+	return order.Loaded > 0 && order.Loaded < order.Weight
+}
+
+// OrderOf returns the index of the Order a Package belongs to in the Orders of the Warehouse, -1 if none
+func (wh Warehouse) OrderOf(pack Package) int {
+	if pack.Order == "" {
+		return -1
+	}
+	for index, order := range wh.Orders {
+		if order.Name == pack.Order {
+			return index
+		}
+	}
+	return -1
+}
+
+// StagingAt returns the index of the Order gathered on a staging tile in the Orders of the Warehouse, -1 if none
+func (wh Warehouse) StagingAt(pos Position) int {
+	for index, order := range wh.Orders {
+		if order.Staging == pos {
+			return index
+		}
+	}
+	return -1
+}
+
+// TruckPosition returns the Position of a Truck from its name
+func (wh Warehouse) TruckPosition(name string) (Position, bool) {
+	for pos, truck := range wh.Trucks {
+		if truck.Name == name {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// hasStagedPackageAt checks if a consolidated Order can be picked up from a staging tile
+func (wh Warehouse) hasStagedPackageAt(pos Position) bool {
+	index := wh.StagingAt(pos)
+	return index != -1 && wh.Orders[index].Consolidated && len(wh.Orders[index].Staged) > 0
+}
+
+// reservedWeight returns the Weight of a Truck promised to the Orders partially loaded in it
+func (wh Warehouse) reservedWeight(truck Truck) Weight {
+	var reserved Weight
+
+	for _, order := range wh.Orders {
+		if order.Truck == truck.Name && order.isLoading() {
+			reserved += order.Weight - order.Loaded
+		}
+	}
+	return reserved
+}
+
+// canLoad checks if a Truck can take a Package, a Truck only takes the first Package of an Order if it can take the
+// whole Order
+func (wh Warehouse) canLoad(truck Truck, pack Package) bool {
+	if truck.TimeUntilReturn != 0 {
+		return false
+	}
+
+	needed := pack.Weight
+	if index := wh.OrderOf(pack); index != -1 {
+		order := wh.Orders[index]
+		if order.Truck != truck.Name || !order.Consolidated {
+			return false
+		}
+		if order.isLoading() {
+			// Its weight is already reserved
+			return true
+		}
+		needed = order.Weight
+	}
+
+	return truck.CurrentWeight+wh.reservedWeight(truck)+needed <= truck.MaxWeight
+}
+
+// orderDestinations returns the Position a ForkLift carrying a Package of an Order has to go to,
+// its staging tile until the Order is consolidated and its Truck afterwards
+func (wh Warehouse) orderDestinations(order Order) positionSet {
+	if !order.Consolidated {
+		return positionSet{order.Staging: {}}
+	}
+	if pos, exists := wh.TruckPosition(order.Truck); exists {
+		return positionSet{pos: {}}
+	}
+	return positionSet{}
+}
+
+func stagePackage(path Path, forklift ForkLift, index int, wh Warehouse, paths []Path, events []Event,
+) ([]Path, int, []Event) {
+	order := &wh.Orders[wh.StagingAt(path.destination)]
+
+	events = append(events, StagePackage{
+		position: path.current, emitterName: forklift.Name,
+		packName: forklift.pack.Name, packWeight: forklift.pack.Weight, orderName: order.Name,
+	})
+
+	order.Staged = append(order.Staged, *forklift.pack)
+	order.Consolidated = len(order.Staged) == len(order.Packages)
+	forklift.pack = nil
+
+	wh.ForkLifts[path.current] = forklift
+	paths[index] = paths[len(paths)-1]
+	return paths[:len(paths)-1], index, events
+}
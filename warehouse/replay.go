@@ -0,0 +1,295 @@
+package warehouse
+
+import "fmt"
+
+// Replay rebuilds the CycleState of a recorded cleaning by applying its Event, without planning any Path
+// Warehouse the Warehouse as it is after the cycles replayed
+// Cycle the number of cycles replayed
+type Replay struct {
+	Warehouse Warehouse
+	Cycle     uint
+}
+
+// NewReplay starts replaying the cleaning of a Warehouse
+func NewReplay(wh Warehouse) *Replay {
+	return &Replay{Warehouse: wh}
+}
+
+// Step applies the Event of the next cycle in the order they occurred, checking that they are consistent with the
+// Warehouse: no ForkLift moves into an occupied tile, takes a Package that isn't there, and so on
+func (replay *Replay) Step(events []Event) (CycleState, error) {
+	for _, event := range events {
+		if err := replay.apply(event); err != nil {
+			return CycleState{}, fmt.Errorf("cycle %d: %w", replay.Cycle+1, err)
+		}
+	}
+	replay.Cycle++
+	return CycleState{Warehouse: replay.Warehouse.Clone(), Events: events}, nil
+}
+
+func (replay *Replay) apply(event Event) error {
+	switch event := event.(type) {
+	case ForkliftWait:
+		_, err := replay.forkliftOf(event)
+		return err
+	case ForkliftMove:
+		return replay.move(event)
+	case PickupPackage:
+		return replay.pickup(event)
+	case UnloadPackage:
+		return replay.unload(event)
+	case DeliverPackage:
+		return replay.deliver(event)
+	case StorePackage:
+		return replay.store(event)
+	case StagePackage:
+		return replay.stage(event)
+	case OrderComplete:
+		return replay.completeOrder(event)
+	case TruckWait:
+		return replay.processTruck(event, false, event.ChargedWeight())
+	case TruckGone:
+		return replay.processTruck(event, true, event.ChargedWeight())
+	default:
+		return fmt.Errorf("invalid type of warehouse event %T", event)
+	}
+}
+
+// forkliftOf returns the ForkLift emitting an Event, which must stand at the Position of the Event
+func (replay *Replay) forkliftOf(event Event) (ForkLift, error) {
+	forklift, exists := replay.Warehouse.ForkLifts[event.AtPosition()]
+	if !exists || forklift.Name != event.EmitterName() {
+		return forklift, fmt.Errorf("no forklift %s at %v", event.EmitterName(), event.AtPosition())
+	}
+	return forklift, nil
+}
+
+// carrierOf returns the ForkLift emitting an Event, which must carry the Package of the Event
+func (replay *Replay) carrierOf(event Event, packName string) (ForkLift, error) {
+	forklift, err := replay.forkliftOf(event)
+	if err != nil {
+		return forklift, err
+	}
+	if pack, carrying := forklift.Carrying(); !carrying || pack.Name != packName {
+		return forklift, fmt.Errorf("forklift %s doesn't carry the package %s", forklift.Name, packName)
+	}
+	return forklift, nil
+}
+
+func (replay *Replay) move(event ForkliftMove) error {
+	wh := replay.Warehouse
+	forklift, err := replay.forkliftOf(event)
+	if err != nil {
+		return err
+	}
+	from, to := event.AtPosition(), event.ToPosition()
+
+	if !isNeighbour(wh, from, to) {
+		return fmt.Errorf("forklift %s can't move from %v to %v, the tiles aren't neighbours", forklift.Name, from, to)
+	}
+	if wh.isObstacle(to) || wh.ForkLifts.Exists(to) {
+		return fmt.Errorf("forklift %s can't move from %v to %v, the tile is occupied", forklift.Name, from, to)
+	}
+	if isLiftFull(wh, from, to) {
+		return fmt.Errorf("forklift %s can't move from %v to %v, the lift is full", forklift.Name, from, to)
+	}
+	delete(wh.ForkLifts, from)
+	wh.ForkLifts[to] = forklift
+	return nil
+}
+
+func (replay *Replay) pickup(event PickupPackage) error {
+	wh := replay.Warehouse
+	forklift, err := replay.forkliftOf(event)
+	if err != nil {
+		return err
+	}
+	if _, carrying := forklift.Carrying(); carrying {
+		return fmt.Errorf("forklift %s already carries a package", forklift.Name)
+	}
+	source := event.FromPosition()
+	if !isNeighbour(wh, event.AtPosition(), source) {
+		return fmt.Errorf("forklift %s isn't next to %v to take the package %s", forklift.Name, source, event.PackageName())
+	}
+
+	var pack Package
+	var found bool
+	if rack, isRack := wh.Racks[source]; isRack && len(rack.Stack) > 0 {
+		pack, found = rack.Stack[len(rack.Stack)-1], true
+		rack.Stack = rack.Stack[:len(rack.Stack)-1]
+		wh.Racks[source] = rack
+	} else if staging := wh.StagingAt(source); staging != -1 && len(wh.Orders[staging].Staged) > 0 {
+		order := &wh.Orders[staging]
+		pack, found = order.Staged[len(order.Staged)-1], true
+		order.Staged = order.Staged[:len(order.Staged)-1]
+	} else if pack, found = wh.Packages[source]; found {
+		delete(wh.Packages, source)
+	}
+	if !found || pack.Name != event.PackageName() {
+		return fmt.Errorf("no package %s to take at %v", event.PackageName(), source)
+	}
+
+	wh.ForkLifts[event.AtPosition()] = forklift.Carry(pack)
+	return nil
+}
+
+func (replay *Replay) unload(event UnloadPackage) error {
+	wh := replay.Warehouse
+	forklift, err := replay.forkliftOf(event)
+	if err != nil {
+		return err
+	}
+	if _, carrying := forklift.Carrying(); carrying {
+		return fmt.Errorf("forklift %s already carries a package", forklift.Name)
+	}
+	pos, exists := wh.TruckPosition(event.TruckName())
+	if !exists || !isNeighbour(wh, event.AtPosition(), pos) {
+		return fmt.Errorf("forklift %s isn't next to the truck %s", forklift.Name, event.TruckName())
+	}
+	truck := wh.Trucks[pos]
+	if len(truck.Cargo) == 0 || truck.Cargo[len(truck.Cargo)-1].Name != event.PackageName() {
+		return fmt.Errorf("the package %s isn't at the back of the truck %s", event.PackageName(), truck.Name)
+	}
+
+	pack := truck.Cargo[len(truck.Cargo)-1]
+	truck.Cargo = truck.Cargo[:len(truck.Cargo)-1]
+	truck.CurrentWeight -= pack.Weight
+	wh.Trucks[pos] = truck
+	wh.ForkLifts[event.AtPosition()] = forklift.Carry(pack)
+	return nil
+}
+
+func (replay *Replay) deliver(event DeliverPackage) error {
+	wh := replay.Warehouse
+	forklift, err := replay.carrierOf(event, event.PackageName())
+	if err != nil {
+		return err
+	}
+	pos, exists := wh.TruckPosition(event.TruckName())
+	if !exists || !isNeighbour(wh, event.AtPosition(), pos) {
+		return fmt.Errorf("forklift %s isn't next to the truck %s", forklift.Name, event.TruckName())
+	}
+	truck := wh.Trucks[pos]
+	if !wh.canLoad(truck, *forklift.pack) {
+		return fmt.Errorf("the truck %s can't load the package %s", truck.Name, forklift.pack.Name)
+	}
+
+	truck.CurrentWeight += forklift.pack.Weight
+	if order := wh.OrderOf(*forklift.pack); order != -1 {
+		wh.Orders[order].Loaded += forklift.pack.Weight
+	}
+	forklift.pack = nil
+	wh.Trucks[pos] = truck
+	wh.ForkLifts[event.AtPosition()] = forklift
+	return nil
+}
+
+func (replay *Replay) store(event StorePackage) error {
+	wh := replay.Warehouse
+	forklift, err := replay.carrierOf(event, event.PackageName())
+	if err != nil {
+		return err
+	}
+	for pos, rack := range wh.Racks {
+		if rack.Name != event.RackName() {
+			continue
+		}
+		if !isNeighbour(wh, event.AtPosition(), pos) {
+			return fmt.Errorf("forklift %s isn't next to the rack %s", forklift.Name, rack.Name)
+		}
+		if len(rack.Stack) >= rack.Slots {
+			return fmt.Errorf("the rack %s is full", rack.Name)
+		}
+
+		rack.Stack = append(rack.Stack, *forklift.pack)
+		forklift.pack = nil
+		wh.Racks[pos] = rack
+		wh.ForkLifts[event.AtPosition()] = forklift
+		return nil
+	}
+	return fmt.Errorf("no rack %s", event.RackName())
+}
+
+func (replay *Replay) stage(event StagePackage) error {
+	wh := replay.Warehouse
+	forklift, err := replay.carrierOf(event, event.PackageName())
+	if err != nil {
+		return err
+	}
+	for index := range wh.Orders {
+		order := &wh.Orders[index]
+		if order.Name != event.OrderName() {
+			continue
+		}
+		if !isNeighbour(wh, event.AtPosition(), order.Staging) {
+			return fmt.Errorf("forklift %s isn't next to the staging tile of the order %s", forklift.Name, order.Name)
+		}
+
+		order.Staged = append(order.Staged, *forklift.pack)
+		order.Consolidated = len(order.Staged) == len(order.Packages)
+		forklift.pack = nil
+		wh.ForkLifts[event.AtPosition()] = forklift
+		return nil
+	}
+	return fmt.Errorf("no order %s", event.OrderName())
+}
+
+func (replay *Replay) completeOrder(event OrderComplete) error {
+	for _, order := range replay.Warehouse.Orders {
+		if order.Name == event.OrderName() {
+			if !order.IsComplete() || order.Truck != event.EmitterName() {
+				return fmt.Errorf("the order %s isn't completely loaded in the truck %s", order.Name, event.EmitterName())
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no order %s", event.OrderName())
+}
+
+// processTruck counts down the return of a Truck the way processTrucks does, a Truck leaving when it's told gone or
+// when its load drops while it's waiting
+func (replay *Replay) processTruck(event Event, gone bool, chargedWeight Weight) error {
+	trucks := replay.Warehouse.Trucks
+	truck, exists := trucks[event.AtPosition()]
+	if !exists || truck.Name != event.EmitterName() {
+		return fmt.Errorf("no truck %s at %v", event.EmitterName(), event.AtPosition())
+	}
+
+	if truck.TimeUntilReturn == 0 && (gone || chargedWeight != truck.CurrentWeight) {
+		truck.TimeUntilReturn = truck.ElapseDischargingTime + 1
+	}
+	if truck.TimeUntilReturn != 0 {
+		truck.TimeUntilReturn--
+		if truck.TimeUntilReturn == 0 {
+			truck.CurrentWeight = 0
+		}
+	}
+	trucks[event.AtPosition()] = truck
+
+	if gone != (truck.TimeUntilReturn != 0) || chargedWeight != truck.CurrentWeight {
+		return fmt.Errorf("the truck %s is told %s with %d loaded, it is %s with %d loaded",
+			truck.Name, truckState(gone), chargedWeight, truckState(truck.TimeUntilReturn != 0), truck.CurrentWeight)
+	}
+	return nil
+}
+
+func truckState(gone bool) string {
+	if gone {
+		return "gone"
+	}
+	return "waiting"
+}
+
+// isNeighbour checks if a tile can be reached from another one in a single step, through a Lift for another floor
+func isNeighbour(wh Warehouse, from Position, to Position) bool {
+	directions := neighbourDirections(wh.Neighbourhood)
+	if _, isLift := wh.LiftAt(from); isLift {
+		directions = append(directions, uPSTAIRS, dOWNSTAIRS)
+	}
+	for _, dir := range directions {
+		if pos, possible := getNewPos(wh, from, dir); possible && pos == to {
+			return true
+		}
+	}
+	return false
+}
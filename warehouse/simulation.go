@@ -0,0 +1,104 @@
+package warehouse
+
+import "fmt"
+
+// Simulation the cleaning of a Warehouse run cycle by cycle, that can be saved and resumed later on
+// Warehouse the Warehouse being cleaned
+// Cycle the number of cycles already run
+// Cycles the number of cycles the cleaning can last
+// Planner the algorithm finding the Path of the ForkLift
+type Simulation struct {
+	Warehouse Warehouse
+	Cycle     uint
+	Cycles    uint
+	Planner   Planner
+	paths     []Path
+}
+
+// Planner the algorithm finding the Path of the ForkLift
+type Planner int
+
+// The Planner of a Simulation
+// DepthFirst explores the paths depth first toward the nearest target, quick in narrow aisles but slow on open floors
+// Dijkstra settles the tiles from the cheapest to reach, its searches growing with the size of the Warehouse
+const (
+	DepthFirst Planner = iota
+	Dijkstra
+)
+
+func (planner Planner) pathFinder() pathFinder {
+	if planner == Dijkstra {
+		return shortestPathToObject
+	}
+	return pathToObject
+}
+
+// Plan the Path followed by a ForkLift, to save a Simulation
+// Current the Position of the ForkLift
+// Destination the Position the ForkLift goes to
+// Steps the Position the ForkLift goes through, a step is repeated for every extra cycle needed to cross its tile
+// Retrieval the cycles left before getting the Package once the ForkLift is by a Rack
+type Plan struct {
+	Current     Position
+	Destination Position
+	Steps       []Position
+	Retrieval   int
+}
+
+// NewSimulation starts the cleaning of a Warehouse, planning the first moves of its ForkLift with a Planner
+func NewSimulation(wh Warehouse, cycles uint, planner Planner) *Simulation {
+	return &Simulation{
+		Warehouse: wh,
+		Cycles:    cycles,
+		Planner:   planner,
+		paths:     refreshPaths(wh, make([]Path, 0), planner.pathFinder()),
+	}
+}
+
+// ResumeSimulation resumes a saved Simulation from its Warehouse and the Plan of its ForkLift
+func ResumeSimulation(wh Warehouse, cycle uint, cycles uint, planner Planner, plans []Plan) (*Simulation, error) {
+	paths := make([]Path, 0, len(plans))
+
+	for _, plan := range plans {
+		if !wh.ForkLifts.Exists(plan.Current) {
+			return nil, fmt.Errorf("no forklift follows the plan starting at %v", plan.Current)
+		}
+		paths = append(paths, Path{
+			current:     plan.Current,
+			destination: plan.Destination,
+			steps:       append([]Position(nil), plan.Steps...),
+			retrieval:   plan.Retrieval,
+		})
+	}
+	return &Simulation{Warehouse: wh, Cycle: cycle, Cycles: cycles, Planner: planner, paths: paths}, nil
+}
+
+// IsOver checks if the Warehouse is clean or if the Simulation ran out of cycles
+func (simulation *Simulation) IsOver() bool {
+	return simulation.Cycle >= simulation.Cycles || isOver(simulation.Warehouse)
+}
+
+// Step runs a cycle of the Simulation
+func (simulation *Simulation) Step() CycleState {
+	paths, events := applyPaths(simulation.Warehouse, simulation.paths)
+	state := CycleState{Warehouse: simulation.Warehouse.Clone(), Events: events}
+
+	simulation.paths = refreshPaths(simulation.Warehouse, paths, simulation.Planner.pathFinder())
+	simulation.Cycle++
+	return state
+}
+
+// Plans returns the Plan followed by the ForkLift, to save the Simulation
+func (simulation *Simulation) Plans() []Plan {
+	plans := make([]Plan, 0, len(simulation.paths))
+
+	for _, path := range simulation.paths {
+		plans = append(plans, Plan{
+			Current:     path.current,
+			Destination: path.destination,
+			Steps:       append([]Position(nil), path.steps...),
+			Retrieval:   path.retrieval,
+		})
+	}
+	return plans
+}
@@ -1,7 +1,9 @@
 package warehouse
 
 import (
+	"errors"
 	"log"
+	"sort"
 )
 
 // Warehouse description of the Warehouse
@@ -10,11 +12,31 @@ import (
 // ForkLifts map of every ForkLift associated to their Position in the Warehouse
 // Packages map of every Package associated to their Position in the Warehouse
 // Trucks map of every Truck associated to their Position in the Warehouse
+// Exits allowed Exits of every constrained tile, a tile missing from the map can be left in any direction
+// Costs cycles needed to enter every costly tile, a tile missing from the map costs a single cycle
+// Neighbourhood the tiles a ForkLift can move to from its own
+// Floors number of floors of the Warehouse
+// Lifts every Lift connecting the floors of the Warehouse
+// Racks map of every Rack associated to their Position in the Warehouse
+// Mission what the ForkLifts have to do with the Package
+// Slotting how the Rack storing a Package is chosen when putting away
+// Orders every Order to ship
+// Walls every tile nothing can go through
 type Warehouse struct {
 	Length, Height int
+	Floors         int
 	Packages       EntityMap[Package]
 	ForkLifts      EntityMap[ForkLift]
 	Trucks         EntityMap[Truck]
+	Racks          EntityMap[Rack]
+	Exits          map[Position]Exits
+	Costs          map[Position]int
+	Neighbourhood  Neighbourhood
+	Lifts          []Lift
+	Mission        Mission
+	Slotting       SlottingRule
+	Orders         []Order
+	Walls          map[Position]bool
 }
 
 // CycleState association of the Warehouse and its associated events at a specific cycle
@@ -27,7 +49,18 @@ type CycleState struct {
 
 // SomethingExistsAt checks if something exists at a position in Warehouse
 func (wh Warehouse) SomethingExistsAt(pos Position) bool {
-	return wh.Packages.Exists(pos) || wh.ForkLifts.Exists(pos) || wh.Trucks.Exists(pos)
+	return wh.Packages.Exists(pos) || wh.ForkLifts.Exists(pos) || wh.Trucks.Exists(pos) || wh.Racks.Exists(pos) ||
+		wh.StagingAt(pos) != -1 || wh.Walls[pos]
+}
+
+// HasPackageAt checks if a Package can be picked up at a position in Warehouse, on the floor,
+// in a Rack when shipping or in a Truck when putting away
+func (wh Warehouse) HasPackageAt(pos Position) bool {
+	if wh.Mission == PutAway {
+		truck, isTruck := wh.Trucks[pos]
+		return wh.Packages.Exists(pos) || (isTruck && len(truck.Cargo) > 0 && truck.TimeUntilReturn == 0)
+	}
+	return wh.Packages.Exists(pos) || len(wh.Racks[pos].Stack) > 0 || wh.hasStagedPackageAt(pos)
 }
 
 // Clone clone a Warehouse
@@ -36,34 +69,229 @@ func (wh Warehouse) Clone() Warehouse {
 
 	cloned.Height = wh.Height
 	cloned.Length = wh.Length
+	cloned.Floors = wh.Floors
+	cloned.Neighbourhood = wh.Neighbourhood
+	cloned.Mission = wh.Mission
+	cloned.Slotting = wh.Slotting
 	cloned.Packages = copyMap(wh.Packages)
 	cloned.ForkLifts = copyMap(wh.ForkLifts)
-	cloned.Trucks = copyMap(wh.Trucks)
+	cloned.Trucks = make(EntityMap[Truck], len(wh.Trucks))
+	for pos, truck := range wh.Trucks {
+		truck.Cargo = append([]Package(nil), truck.Cargo...)
+		cloned.Trucks[pos] = truck
+	}
+	cloned.Racks = make(EntityMap[Rack], len(wh.Racks))
+	for pos, rack := range wh.Racks {
+		rack.Stack = append([]Package(nil), rack.Stack...)
+		cloned.Racks[pos] = rack
+	}
+	// The tile layers never change during the cleaning, they can be shared
+	cloned.Exits = wh.Exits
+	cloned.Costs = wh.Costs
+	cloned.Lifts = wh.Lifts
+	cloned.Walls = wh.Walls
+	cloned.Orders = make([]Order, len(wh.Orders))
+	for index, order := range wh.Orders {
+		order.Staged = append([]Package(nil), order.Staged...)
+		cloned.Orders[index] = order
+	}
 
 	return cloned
 }
 
+// ExitsAt returns the Exits allowed at a Position of the Warehouse
+func (wh Warehouse) ExitsAt(pos Position) Exits {
+	exits, constrained := wh.Exits[pos]
+	if !constrained {
+		return AllExits
+	}
+	return exits
+}
+
+// CostAt returns how many cycles a ForkLift needs to enter a Position of the Warehouse
+func (wh Warehouse) CostAt(pos Position) int {
+	cost, costly := wh.Costs[pos]
+	if !costly {
+		return 1
+	}
+	return cost
+}
+
+// AddLane constrains every tile between from and to, both included, to never be left against the lane direction
+func (wh *Warehouse) AddLane(from Position, to Position) error {
+	if from == to || from.Floor != to.Floor || (from.X != to.X && from.Y != to.Y) {
+		return errors.New("a lane must be a horizontal or vertical line of at least two tiles")
+	}
+	if !wh.isInside(from) || !wh.isInside(to) {
+		return errors.New("a lane must be inside the warehouse")
+	}
+	if wh.Exits == nil {
+		wh.Exits = make(map[Position]Exits)
+	}
+
+	forward := directionBetween(from, to)
+	step := directionDelta(forward)
+
+	for pos := from; ; pos = (Position{X: pos.X + step.X, Y: pos.Y + step.Y, Floor: pos.Floor}) {
+		wh.Exits[pos] = wh.ExitsAt(pos) & laneExits(forward)
+		if pos == to {
+			return nil
+		}
+	}
+}
+
+// FloorCount returns the number of floors of the Warehouse, a Warehouse has at least a ground floor
+func (wh Warehouse) FloorCount() int {
+	if wh.Floors < 1 {
+		return 1
+	}
+	return wh.Floors
+}
+
+// LiftAt returns the Lift stopping at a Position of the Warehouse, if any
+func (wh Warehouse) LiftAt(pos Position) (Lift, bool) {
+	for _, lift := range wh.Lifts {
+		if lift.X == pos.X && lift.Y == pos.Y && lift.Serves(pos.Floor) {
+			return lift, true
+		}
+	}
+	return Lift{}, false
+}
+
+func (wh Warehouse) isInside(pos Position) bool {
+	return pos.X >= 0 && pos.X < wh.Length && pos.Y >= 0 && pos.Y < wh.Height &&
+		pos.Floor >= 0 && pos.Floor < wh.FloorCount()
+}
+
+// isObstacle checks if a Position is blocked by something that doesn't move
+func (wh Warehouse) isObstacle(pos Position) bool {
+	return !wh.isInside(pos) || wh.Packages.Exists(pos) || wh.Trucks.Exists(pos) || wh.Racks.Exists(pos) ||
+		wh.StagingAt(pos) != -1 || wh.Walls[pos]
+}
+
 // EntityMap a map of entities
-type EntityMap[T Package | ForkLift | Truck] map[Position]T
+type EntityMap[T Package | ForkLift | Truck | Rack] map[Position]T
 
-// Position a position in a 2D plane
+// SortedPositions returns the Position of a map in reading order, floor by floor, for the iterations to be stable
+func SortedPositions[T any](tiles map[Position]T) []Position {
+	positions := make([]Position, 0, len(tiles))
+	for pos := range tiles {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(lhs, rhs int) bool {
+		return positions[lhs].before(positions[rhs])
+	})
+	return positions
+}
+
+// Position a position in a 2D plane of a floor
 // X the position in the X axis
 // Y the position in the Y axis
+// Floor the floor of the plane, the ground floor being 0
 type Position struct {
-	X, Y int
+	X, Y  int
+	Floor int
+}
+
+// before checks if a Position comes before another one in reading order, floor by floor
+func (pos Position) before(other Position) bool {
+	if pos.Floor != other.Floor {
+		return pos.Floor < other.Floor
+	}
+	if pos.Y != other.Y {
+		return pos.Y < other.Y
+	}
+	return pos.X < other.X
 }
 
 // Package description of a Package
 // Weight weight of the Package
 // Name name of the Package
+// Order name of the Order the Package belongs to, if any
 type Package struct {
 	Weight Weight
 	Name   string
+	Order  string
 }
 
 // Weight a weight
 type Weight int
 
+// Mission what the ForkLifts have to do with the Package of the Warehouse
+type Mission int
+
+// The Mission of a Warehouse
+// Outbound takes every Package of the Warehouse floor and Racks to the Trucks
+// PutAway unloads the Cargo of the Trucks and stores it in the Racks
+const (
+	Outbound Mission = iota
+	PutAway
+)
+
+// SlottingRule how the Rack storing a Package is chosen when putting away
+type SlottingRule int
+
+// The SlottingRule of a Warehouse
+// NearestSlot stores the Package in the nearest Rack with a free slot
+// LowestSlot stores the Package in the least filled Rack, to keep them quick to retrieve
+const (
+	NearestSlot SlottingRule = iota
+	LowestSlot
+)
+
+// Neighbourhood the tiles a ForkLift can reach in a single move
+type Neighbourhood int
+
+// The Neighbourhood of a Warehouse
+// FourConnected moves up, right, down and left
+// EightConnected moves diagonally too, without cutting the corners of obstacles
+// Hexagonal moves on a grid of hexagons whose odd rows are shifted half a tile to the right
+const (
+	FourConnected Neighbourhood = iota
+	EightConnected
+	Hexagonal
+)
+
+// RowShift the half tiles a row of the Warehouse is shifted to the right by, the odd rows of an hexagonal grid
+// being shifted by one
+func (wh Warehouse) RowShift(y int) int {
+	if wh.Neighbourhood == Hexagonal && y%2 != 0 {
+		return 1
+	}
+	return 0
+}
+
+// Exits set of the directions a ForkLift is allowed to leave a tile through
+type Exits uint8
+
+// The Exits of a tile, they can be combined
+const (
+	ExitUp Exits = 1 << iota
+	ExitRight
+	ExitDown
+	ExitLeft
+	ExitUpRight
+	ExitDownRight
+	ExitDownLeft
+	ExitUpLeft
+	AllExits = ExitUp | ExitRight | ExitDown | ExitLeft | ExitUpRight | ExitDownRight | ExitDownLeft | ExitUpLeft
+)
+
+// Has checks if every given Exits are allowed
+func (exits Exits) Has(other Exits) bool {
+	return exits&other == other
+}
+
+// Flow returns the only direction the Exits can be left through, the tiles of a lane are given by its direction
+func (exits Exits) Flow() (Exits, bool) {
+	for dir := uP; dir <= uPLEFT; dir++ {
+		if exits == exitOf(dir) || exits == laneExits(dir) {
+			return exitOf(dir), true
+		}
+	}
+	return 0, false
+}
+
 // ForkLift description of a ForkLift
 // Name name of the ForkLift
 type ForkLift struct {
@@ -71,18 +299,67 @@ type ForkLift struct {
 	pack *Package
 }
 
+// Carry returns the ForkLift carrying a Package, to restore a saved Warehouse
+func (forklift ForkLift) Carry(pack Package) ForkLift {
+	forklift.pack = &pack
+	return forklift
+}
+
+// Rack description of a storage Rack stacking Package on a single tile, only its top Package can be picked up
+// Name name of the Rack
+// Slots how many Package the Rack can hold
+// RetrievalTime how many cycles are needed to reach each level of the Rack
+// Stack the Package stored in the Rack, from the bottom level to the top one
+type Rack struct {
+	Name          string
+	Slots         int
+	RetrievalTime int
+	Stack         []Package
+}
+
+// Carrying returns the Package carried by the ForkLift, if any
+func (forklift ForkLift) Carrying() (Package, bool) {
+	if forklift.pack == nil {
+		return Package{}, false
+	}
+	return *forklift.pack, true
+}
+
+// Lift description of a Lift connecting floors of the Warehouse
+// Name name of the Lift
+// X position of the Lift in the X axis of every floor it serves
+// Y position of the Lift in the Y axis of every floor it serves
+// LowestFloor lowest floor served by the Lift
+// HighestFloor highest floor served by the Lift
+// TransferTime how many cycles are needed to go from a floor to the next one
+// Capacity how many ForkLifts can stand in the Lift at once, on every floor it serves
+type Lift struct {
+	Name                      string
+	X, Y                      int
+	LowestFloor, HighestFloor int
+	TransferTime              int
+	Capacity                  int
+}
+
+// Serves checks if the Lift stops at a floor
+func (lift Lift) Serves(floor int) bool {
+	return floor >= lift.LowestFloor && floor <= lift.HighestFloor
+}
+
 // Truck description of a Truck
 // Name name of the Truck
 // MaxWeight maximum Weight of the Truck
 // CurrentWeight actual loaded Weight of the Truck
 // ElapseDischargingTime how many cycles are needed for the Truck to return
 // TimeUntilReturn the actual cycles left for the Truck to return
+// Cargo the Package the Truck comes with when putting away, from the first loaded to the last one
 type Truck struct {
 	Name                  string
 	MaxWeight             Weight
 	CurrentWeight         Weight
 	ElapseDischargingTime int
 	TimeUntilReturn       int
+	Cargo                 []Package
 }
 
 // Exists check if something exists at this Position on the EntityMap
@@ -91,18 +368,13 @@ func (ettMap EntityMap[T]) Exists(pos Position) bool {
 	return exists
 }
 
-// CleanWarehouse clean the Warehouse and populates the CycleState channel
-func CleanWarehouse(wh Warehouse, ch chan CycleState, cycles uint) {
+// CleanWarehouse clean the Warehouse with a Planner and populates the CycleState channel
+func CleanWarehouse(wh Warehouse, ch chan CycleState, cycles uint, planner Planner) {
 	defer close(ch)
-	paths := refreshPaths(wh, make([]Path, 0))
-	var events []Event
-
-	for ; cycles != 0 && !isOver(wh); cycles-- {
-		paths, events = applyPaths(wh, paths)
+	simulation := NewSimulation(wh, cycles, planner)
 
-		ch <- CycleState{Warehouse: wh.Clone(), Events: events}
-
-		paths = refreshPaths(wh, paths)
+	for !simulation.IsOver() {
+		ch <- simulation.Step()
 	}
 }
 
@@ -119,15 +391,22 @@ func applyPaths(wh Warehouse, paths []Path) ([]Path, []Event) {
 			delete(waitingForklifts, path.current)
 
 			if len(path.steps) == 0 {
-				if wh.Trucks.Exists(path.destination) {
-					paths, index, events = dropPackage(path, forklift, index, wh.ForkLifts,
-						wh.Trucks, paths, fullTrucks, events)
-				} else if wh.Packages.Exists(path.destination) {
-					paths, events = takePackage(path, forklift, index, wh.ForkLifts, wh.Packages,
-						paths, events)
+				if forklift.pack == nil && wh.HasPackageAt(path.destination) {
+					paths, index, events = takePackage(path, forklift, index, wh, paths, events)
+				} else if forklift.pack != nil && wh.Trucks.Exists(path.destination) {
+					paths, index, events = dropPackage(path, forklift, index, wh, paths, fullTrucks, events)
+				} else if forklift.pack != nil && wh.StagingAt(path.destination) != -1 {
+					paths, index, events = stagePackage(path, forklift, index, wh, paths, events)
+				} else if forklift.pack != nil && wh.Racks.Exists(path.destination) {
+					paths, index, events = storePackage(path, forklift, index, wh, paths, events)
+				} else {
+					// The target is gone, a new path will be searched
+					events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: TargetGone})
+					paths[index] = paths[len(paths)-1]
+					paths = paths[:len(paths)-1]
 				}
 			} else {
-				paths, events = moveForkLift(path, forklift, index, wh.ForkLifts, paths, events)
+				paths, events = moveForkLift(path, forklift, index, wh, paths, events)
 				index++
 			}
 		} else {
@@ -135,10 +414,10 @@ func applyPaths(wh Warehouse, paths []Path) ([]Path, []Event) {
 		}
 	}
 
-	for pos := range waitingForklifts {
+	for _, pos := range SortedPositions(waitingForklifts) {
 		waiting := wh.ForkLifts[pos]
 
-		events = append(events, ForkliftWait{forkliftName: waiting.Name, position: pos})
+		events = append(events, ForkliftWait{forkliftName: waiting.Name, position: pos, reason: Idle})
 	}
 
 	events = processTrucks(wh, fullTrucks, events)
@@ -146,10 +425,17 @@ func applyPaths(wh Warehouse, paths []Path) ([]Path, []Event) {
 	return paths, events
 }
 
-func moveForkLift(path Path, forklift ForkLift, index int, forkLifts EntityMap[ForkLift],
+func moveForkLift(path Path, forklift ForkLift, index int, wh Warehouse,
 	paths []Path, events []Event,
 ) ([]Path, []Event) {
-	if !forkLifts.Exists(path.steps[0]) {
+	forkLifts := wh.ForkLifts
+
+	if path.steps[0] == path.current {
+		// The forklift is still crossing a costly tile
+		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: Crossing})
+
+		paths[index].steps = path.steps[1:]
+	} else if !forkLifts.Exists(path.steps[0]) && !isLiftFull(wh, path.current, path.steps[0]) {
 		events = append(events, ForkliftMove{
 			forkliftName:  forklift.Name,
 			eventPosition: path.current, target: path.steps[0],
@@ -161,7 +447,7 @@ func moveForkLift(path Path, forklift ForkLift, index int, forkLifts EntityMap[F
 		paths[index].current = path.steps[0]
 		paths[index].steps = path.steps[1:]
 	} else {
-		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current})
+		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: Blocked})
 
 		paths[index] = paths[len(paths)-1]
 		paths = paths[:len(paths)-1]
@@ -170,38 +456,92 @@ func moveForkLift(path Path, forklift ForkLift, index int, forkLifts EntityMap[F
 	return paths, events
 }
 
-func takePackage(path Path, forklift ForkLift, index int, forkLifts EntityMap[ForkLift],
-	packages EntityMap[Package], paths []Path, events []Event,
-) ([]Path, []Event) {
-	events = append(events, PickupPackage{
-		position: path.current, emitterName: forklift.Name,
-		packName: packages[path.destination].Name,
-	})
+func takePackage(path Path, forklift ForkLift, index int, wh Warehouse, paths []Path, events []Event,
+) ([]Path, int, []Event) {
+	var pack Package
 
-	// Take package from map
-	pack := packages[path.destination]
-	delete(packages, path.destination)
+	if rack, isRack := wh.Racks[path.destination]; isRack {
+		// Reaching the top of the rack takes the retrieval time of every level
+		if path.retrieval == 0 {
+			paths[index].retrieval = len(rack.Stack) * rack.RetrievalTime
+		}
+		paths[index].retrieval--
+
+		if paths[index].retrieval > 0 {
+			events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: Retrieving})
+			return paths, index + 1, events
+		}
+
+		// Take package from the top of the rack
+		pack = rack.Stack[len(rack.Stack)-1]
+		rack.Stack = rack.Stack[:len(rack.Stack)-1]
+		wh.Racks[path.destination] = rack
+
+		events = append(events, PickupPackage{
+			position: path.current, emitterName: forklift.Name,
+			packName: pack.Name, packWeight: pack.Weight, source: path.destination,
+		})
+	} else if staging := wh.StagingAt(path.destination); staging != -1 {
+		// Take package from the staging tile
+		order := &wh.Orders[staging]
+		pack = order.Staged[len(order.Staged)-1]
+		order.Staged = order.Staged[:len(order.Staged)-1]
+
+		events = append(events, PickupPackage{
+			position: path.current, emitterName: forklift.Name,
+			packName: pack.Name, packWeight: pack.Weight, source: path.destination,
+		})
+	} else if truck, isTruck := wh.Trucks[path.destination]; isTruck {
+		// Take package from the back of the truck
+		pack = truck.Cargo[len(truck.Cargo)-1]
+		truck.Cargo = truck.Cargo[:len(truck.Cargo)-1]
+		truck.CurrentWeight -= pack.Weight
+		wh.Trucks[path.destination] = truck
+
+		events = append(events, UnloadPackage{
+			position: path.current, emitterName: forklift.Name,
+			packName: pack.Name, packWeight: pack.Weight, truckName: truck.Name,
+		})
+	} else {
+		// Take package from map
+		pack = wh.Packages[path.destination]
+		delete(wh.Packages, path.destination)
+
+		events = append(events, PickupPackage{
+			position: path.current, emitterName: forklift.Name,
+			packName: pack.Name, packWeight: pack.Weight, source: path.destination,
+		})
+	}
 
 	// Give package to forklift
 	forklift.pack = &pack
-	forkLifts[path.current] = forklift
+	wh.ForkLifts[path.current] = forklift
 
 	paths[index] = paths[len(paths)-1]
-	return paths[:len(paths)-1], events
+	return paths[:len(paths)-1], index, events
 }
 
-func dropPackage(path Path, forklift ForkLift, index int, forkLifts EntityMap[ForkLift],
-	trucks EntityMap[Truck], paths []Path, fulltrucks positionSet, events []Event,
+func dropPackage(path Path, forklift ForkLift, index int, wh Warehouse,
+	paths []Path, fulltrucks positionSet, events []Event,
 ) ([]Path, int, []Event) {
+	forkLifts, trucks := wh.ForkLifts, wh.Trucks
 	truck := trucks[path.destination]
 
-	if truck.CurrentWeight+forklift.pack.Weight <= truck.MaxWeight && truck.TimeUntilReturn == 0 {
+	if wh.canLoad(truck, *forklift.pack) {
 		events = append(events, DeliverPackage{
 			position: path.current, emitterName: forklift.Name,
-			packName: forklift.pack.Name,
+			packName: forklift.pack.Name, packWeight: forklift.pack.Weight, truckName: truck.Name,
 		})
 
 		truck.CurrentWeight += forklift.pack.Weight
+		if order := wh.OrderOf(*forklift.pack); order != -1 {
+			wh.Orders[order].Loaded += forklift.pack.Weight
+			if wh.Orders[order].IsComplete() {
+				events = append(events, OrderComplete{
+					orderName: wh.Orders[order].Name, truckName: truck.Name, position: path.destination,
+				})
+			}
+		}
 		forklift.pack = nil
 
 		forkLifts[path.current] = forklift
@@ -209,7 +549,7 @@ func dropPackage(path Path, forklift ForkLift, index int, forkLifts EntityMap[Fo
 		paths[index] = paths[len(paths)-1]
 		paths = paths[:len(paths)-1]
 	} else {
-		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current})
+		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: FullTruck})
 		fulltrucks[path.destination] = struct{}{}
 
 		index++
@@ -218,18 +558,80 @@ func dropPackage(path Path, forklift ForkLift, index int, forkLifts EntityMap[Fo
 	return paths, index, events
 }
 
+// isLiftFull checks if a ForkLift can't get in the Lift stopping at the next step of its path
+func isLiftFull(wh Warehouse, current Position, next Position) bool {
+	lift, isLift := wh.LiftAt(next)
+	if !isLift {
+		return false
+	}
+	if current.X == lift.X && current.Y == lift.Y && lift.Serves(current.Floor) {
+		// Already in the lift
+		return false
+	}
+
+	inLift := 0
+	for floor := lift.LowestFloor; floor <= lift.HighestFloor; floor++ {
+		if wh.ForkLifts.Exists(Position{X: lift.X, Y: lift.Y, Floor: floor}) {
+			inLift++
+		}
+	}
+
+	return inLift >= lift.Capacity
+}
+
+func storePackage(path Path, forklift ForkLift, index int, wh Warehouse, paths []Path, events []Event,
+) ([]Path, int, []Event) {
+	rack := wh.Racks[path.destination]
+
+	if len(rack.Stack) >= rack.Slots {
+		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: FullRack})
+
+		paths[index] = paths[len(paths)-1]
+		return paths[:len(paths)-1], index, events
+	}
+
+	// Reaching the first free level of the rack takes the retrieval time of every level
+	if path.retrieval == 0 {
+		paths[index].retrieval = (len(rack.Stack) + 1) * rack.RetrievalTime
+	}
+	paths[index].retrieval--
+
+	if paths[index].retrieval > 0 {
+		events = append(events, ForkliftWait{forkliftName: forklift.Name, position: path.current, reason: Retrieving})
+		return paths, index + 1, events
+	}
+
+	events = append(events, StorePackage{
+		position: path.current, emitterName: forklift.Name,
+		packName: forklift.pack.Name, packWeight: forklift.pack.Weight, rackName: rack.Name,
+	})
+
+	rack.Stack = append(rack.Stack, *forklift.pack)
+	forklift.pack = nil
+
+	wh.ForkLifts[path.current] = forklift
+	wh.Racks[path.destination] = rack
+	paths[index] = paths[len(paths)-1]
+	return paths[:len(paths)-1], index, events
+}
+
 func processTrucks(wh Warehouse, fullTrucks positionSet, events []Event) []Event {
 	for pos, truck := range wh.Trucks {
-		if truck.TimeUntilReturn == 0 && truck.MaxWeight <= truck.CurrentWeight {
+		// Trucks being unloaded stay until the end
+		if wh.Mission == Outbound && truck.TimeUntilReturn == 0 && truck.MaxWeight <= truck.CurrentWeight {
 			fullTrucks[pos] = struct{}{}
 		}
 	}
 
 	for pos := range fullTrucks {
-		sendTruck(pos, wh.Trucks)
+		// A truck never leaves with part of an order
+		if wh.reservedWeight(wh.Trucks[pos]) == 0 {
+			sendTruck(pos, wh.Trucks)
+		}
 	}
 
-	for pos, truck := range wh.Trucks {
+	for _, pos := range SortedPositions(wh.Trucks) {
+		truck := wh.Trucks[pos]
 		if truck.TimeUntilReturn == 0 {
 			events = append(events, createTruckWait(truck, pos))
 		} else {
@@ -260,7 +662,7 @@ func sendTruck(pos Position, trucks EntityMap[Truck]) {
 	}
 }
 
-func copyMap[T Package | ForkLift | Truck](toClone map[Position]T) map[Position]T {
+func copyMap[T Package | ForkLift | Truck | Rack](toClone map[Position]T) map[Position]T {
 	ret := make(map[Position]T)
 	for key, value := range toClone {
 		ret[key] = value
@@ -273,7 +675,7 @@ func isOver(wh Warehouse) bool {
 		return true
 	}
 
-	if len(wh.Packages) > 0 {
+	if len(getPackagesPositions(wh)) > 0 {
 		return false
 	}
 
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// inputWriter writes the lines of an input file, keeping track of the level they describe
+// level the floor described by the last lines, given by the last `level` line
+// floors the number of floors described so far
+type inputWriter struct {
+	strings.Builder
+	level  int
+	floors int
+}
+
+func (writer *inputWriter) line(format string, args ...any) {
+	writer.WriteString(fmt.Sprintf(format, args...) + "\n")
+}
+
+// at moves the writer to the level of a Position
+func (writer *inputWriter) at(pos Position) {
+	if pos.Floor == writer.level {
+		return
+	}
+	writer.line("level %d", pos.Floor)
+	writer.level = pos.Floor
+	if pos.Floor >= writer.floors {
+		writer.floors = pos.Floor + 1
+	}
+}
+
+// writeScenarioFile writes a scenario in JSON when its path has the .json extension, in the line format otherwise
+func writeScenarioFile(path string, warehouse Warehouse, cycles uint) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return writeJSONFile(file, warehouse, cycles)
+	}
+	return writeInputFile(file, warehouse, cycles)
+}
+
+// writeInputFile writes a Warehouse in the line format, parseInputFile reading it back as the same Warehouse,
+// including the Package carried, the Truck loads and the progress of the Order of a running Warehouse
+func writeInputFile(file io.Writer, warehouse Warehouse, cycles uint) error {
+	if err := checkColors(warehouse); err != nil {
+		return err
+	}
+	if err := checkLineFormatNames(warehouse); err != nil {
+		return err
+	}
+	writer := &inputWriter{floors: 1}
+
+	writer.line("%d %d %d", warehouse.Length, warehouse.Height, cycles)
+	if warehouse.Neighbourhood != FourConnected {
+		writer.line("neighbourhood %s", nameOf(nameToNeighbourhood, warehouse.Neighbourhood))
+	}
+	if warehouse.Mission != Outbound || warehouse.Slotting != NearestSlot {
+		writer.line("mission %s %s", nameOf(nameToMission, warehouse.Mission), nameOf(nameToSlotting, warehouse.Slotting))
+	}
+
+	writer.line("packages")
+	for _, pos := range SortedPositions(warehouse.Packages) {
+		pack := warehouse.Packages[pos]
+		writer.at(pos)
+		writer.line("%s %d %d %s", pack.Name, pos.X, pos.Y, colorOf(pack.Weight))
+	}
+	writer.line("forklifts")
+	for _, pos := range SortedPositions(warehouse.ForkLifts) {
+		writer.at(pos)
+		writer.line("%s %d %d", warehouse.ForkLifts[pos].Name, pos.X, pos.Y)
+	}
+	writer.line("trucks")
+	for _, pos := range SortedPositions(warehouse.Trucks) {
+		truck := warehouse.Trucks[pos]
+		writer.at(pos)
+		writer.line("%s %d %d %d %d", truck.Name, pos.X, pos.Y, truck.MaxWeight, truck.ElapseDischargingTime)
+	}
+
+	writeLayout(writer, warehouse)
+	writeState(writer, warehouse)
+
+	if warehouse.FloorCount() > writer.floors {
+		writer.at(Position{Floor: warehouse.FloorCount() - 1})
+	}
+	_, err := io.WriteString(file, writer.String())
+	return err
+}
+
+// writeLayout writes the tiles, the Lift, the Rack and the Order of the Warehouse
+func writeLayout(writer *inputWriter, warehouse Warehouse) {
+	for _, pos := range SortedPositions(warehouse.Walls) {
+		writer.at(pos)
+		writer.line("wall %d %d", pos.X, pos.Y)
+	}
+	for _, pos := range SortedPositions(warehouse.Exits) {
+		writer.at(pos)
+		writer.line("exits %d %d %s", pos.X, pos.Y, strings.Join(exitNames(warehouse.Exits[pos]), ","))
+	}
+	for floor := 0; floor < warehouse.FloorCount(); floor++ {
+		writeCosts(writer, warehouse, floor)
+	}
+	for _, lift := range warehouse.Lifts {
+		writer.line("lift %s %d %d %d %d %d %d", lift.Name, lift.X, lift.Y, lift.LowestFloor, lift.HighestFloor,
+			lift.TransferTime, lift.Capacity)
+	}
+	for _, pos := range SortedPositions(warehouse.Racks) {
+		rack := warehouse.Racks[pos]
+		writer.at(pos)
+		writer.line("rack %s %d %d %d %d%s", rack.Name, pos.X, pos.Y, rack.Slots, rack.RetrievalTime,
+			packageList(rack.Stack))
+	}
+	for _, order := range warehouse.Orders {
+		writer.at(order.Staging)
+		writer.line("order %s %d %d %s %s", order.Name, order.Staging.X, order.Staging.Y, order.Truck,
+			strings.Join(order.Packages, " "))
+	}
+}
+
+func writeCosts(writer *inputWriter, warehouse Warehouse, floor int) {
+	costly := false
+	for pos := range warehouse.Costs {
+		costly = costly || pos.Floor == floor
+	}
+	if !costly {
+		return
+	}
+
+	writer.at(Position{Floor: floor})
+	writer.line("costs")
+	for y := 0; y < warehouse.Height; y++ {
+		costs := make([]string, warehouse.Length)
+		for x := range costs {
+			costs[x] = fmt.Sprint(warehouse.CostAt(Position{X: x, Y: y, Floor: floor}))
+		}
+		writer.line("%s", strings.Join(costs, " "))
+	}
+}
+
+// writeState writes what happened to the Truck, the ForkLift and the Order of a Warehouse
+func writeState(writer *inputWriter, warehouse Warehouse) {
+	for _, pos := range SortedPositions(warehouse.Trucks) {
+		truck := warehouse.Trucks[pos]
+		var cargoWeight Weight
+		for _, pack := range truck.Cargo {
+			cargoWeight += pack.Weight
+		}
+
+		if len(truck.Cargo) != 0 {
+			writer.line("cargo %s%s", truck.Name, packageList(truck.Cargo))
+		}
+		if truck.CurrentWeight != cargoWeight || truck.TimeUntilReturn != 0 {
+			writer.line("load %s %d %d", truck.Name, truck.CurrentWeight, truck.TimeUntilReturn)
+		}
+	}
+	for _, pos := range SortedPositions(warehouse.ForkLifts) {
+		forklift := warehouse.ForkLifts[pos]
+		if pack, carrying := forklift.Carrying(); carrying {
+			writer.line("carry %s%s", forklift.Name, packageList([]Package{pack}))
+		}
+	}
+	for _, order := range warehouse.Orders {
+		if order.Loaded == 0 && !order.Consolidated && len(order.Staged) == 0 {
+			continue
+		}
+		progress := "gathering"
+		if order.Consolidated {
+			progress = "consolidated"
+		}
+		writer.line("progress %s %d %s%s", order.Name, order.Loaded, progress, packageList(order.Staged))
+	}
+}
+
+// checkLineFormatNames checks that every name can be written in the line format and read back
+func checkLineFormatNames(warehouse Warehouse) error {
+	var names []string
+	var lineNames []string
+
+	for _, pack := range warehouse.Packages {
+		lineNames = append(lineNames, pack.Name)
+	}
+	for _, forklift := range warehouse.ForkLifts {
+		lineNames = append(lineNames, forklift.Name)
+		if pack, carrying := forklift.Carrying(); carrying {
+			names = append(names, pack.Name)
+		}
+	}
+	for _, truck := range warehouse.Trucks {
+		lineNames = append(lineNames, truck.Name)
+		for _, pack := range truck.Cargo {
+			names = append(names, pack.Name)
+		}
+	}
+	for _, rack := range warehouse.Racks {
+		names = append(names, rack.Name)
+		for _, pack := range rack.Stack {
+			names = append(names, pack.Name)
+		}
+	}
+	for _, lift := range warehouse.Lifts {
+		names = append(names, lift.Name)
+	}
+	for _, order := range warehouse.Orders {
+		names = append(names, order.Name)
+		names = append(names, order.Packages...)
+		for _, pack := range order.Staged {
+			names = append(names, pack.Name)
+		}
+	}
+
+	// A line starting with the name of an entity mustn't be taken for a directive or a header
+	for _, name := range lineNames {
+		_, isDirective := directiveParsers[name]
+		_, isHeader := sectionHeaders[name]
+		if isDirective || isHeader {
+			return fmt.Errorf("name %q can't be written in the line format, it is a keyword", name)
+		}
+	}
+	for _, name := range append(names, lineNames...) {
+		if name == "" || strings.HasPrefix(name, "--") || strings.ContainsRune(name, ':') ||
+			strings.IndexFunc(name, unicode.IsSpace) != -1 {
+			return fmt.Errorf("name %q can't be written in the line format", name)
+		}
+	}
+	return nil
+}
+
+// nameOf returns the name of a value in a map of names
+func nameOf[T comparable](names map[string]T, value T) string {
+	for name, named := range names {
+		if named == value {
+			return name
+		}
+	}
+	return ""
+}
+
+// colorOf returns the color of a Package from its Weight
+func colorOf(weight Weight) string {
+	return nameOf(colorToWeight, weight)
+}
+
+// exitNames returns the names of the directions of Exits, in the order of the directions
+func exitNames(exits Exits) []string {
+	var names []string
+
+	for _, name := range []string{"up", "right", "down", "left", "up-right", "down-right", "down-left", "up-left"} {
+		if exits.Has(nameToExit[name]) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{"none"}
+	}
+	return names
+}
+
+// packageList formats Package as name:color, each one preceded by a space
+func packageList(packages []Package) string {
+	var list string
+
+	for _, pack := range packages {
+		list += fmt.Sprintf(" %s:%s", pack.Name, colorOf(pack.Weight))
+	}
+	return list
+}
+
+// checkColors checks that the Weight of every Package has a color
+func checkColors(warehouse Warehouse) error {
+	var packages []Package
+
+	for _, pack := range warehouse.Packages {
+		packages = append(packages, pack)
+	}
+	for _, forklift := range warehouse.ForkLifts {
+		if pack, carrying := forklift.Carrying(); carrying {
+			packages = append(packages, pack)
+		}
+	}
+	for _, truck := range warehouse.Trucks {
+		packages = append(packages, truck.Cargo...)
+	}
+	for _, rack := range warehouse.Racks {
+		packages = append(packages, rack.Stack...)
+	}
+	for _, order := range warehouse.Orders {
+		packages = append(packages, order.Staged...)
+	}
+
+	for _, pack := range packages {
+		if colorOf(pack.Weight) == "" {
+			return fmt.Errorf("package %s: no color weighs %d", pack.Name, pack.Weight)
+		}
+	}
+	return nil
+}
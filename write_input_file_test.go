@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// TestScenarioRoundTrip writes generated warehouses and every cycle of their runs in the line format and in JSON,
+// and checks that they're read back unchanged, with the packages carried, the truck loads, the rack stacks and the
+// progress of the orders
+func TestScenarioRoundTrip(t *testing.T) {
+	var carried, loaded, stacked, staged bool
+
+	for seed := int64(1); seed <= 40; seed++ {
+		params := defaultGeneratorParameters()
+		params.Packages, params.Trucks, params.Cycles, params.Seed = 8, 2, 60, seed
+		wh, err := generateWarehouse(params)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		wh = addRackAndOrder(wh, rand.New(rand.NewSource(seed)))
+
+		run := fmt.Sprintf("seed %d", seed)
+		simulation := NewSimulation(wh, params.Cycles, Dijkstra)
+		checkRoundTrip(t, run, 0, simulation.Warehouse, params.Cycles)
+		for !simulation.IsOver() {
+			state := simulation.Step()
+			checkRoundTrip(t, run, simulation.Cycle, state.Warehouse, params.Cycles)
+
+			for _, forklift := range state.Warehouse.ForkLifts {
+				_, carrying := forklift.Carrying()
+				carried = carried || carrying
+			}
+			for _, truck := range state.Warehouse.Trucks {
+				loaded = loaded || truck.CurrentWeight != 0
+			}
+			for _, rack := range state.Warehouse.Racks {
+				stacked = stacked || len(rack.Stack) != 0
+			}
+			for _, order := range state.Warehouse.Orders {
+				staged = staged || len(order.Staged) != 0 || order.Loaded != 0
+			}
+		}
+	}
+
+	if !carried || !loaded || !stacked || !staged {
+		t.Errorf("the runs should cover carried packages %t, truck loads %t, rack stacks %t and order progress %t",
+			carried, loaded, stacked, staged)
+	}
+}
+
+// addRackAndOrder turns the first package of a generated Warehouse into a Rack stacking it, and the second one into
+// the staging tile of an Order of the next two packages, loaded in the first Truck
+func addRackAndOrder(wh Warehouse, rng *rand.Rand) Warehouse {
+	packages := SortedPositions(wh.Packages)
+	colors := []string{"yellow", "green", "blue"}
+
+	wh.Racks[packages[0]] = Rack{
+		Name:          "r1",
+		Slots:         2 + rng.Intn(3),
+		RetrievalTime: 1 + rng.Intn(3),
+		Stack: []Package{
+			wh.Packages[packages[0]],
+			{Name: "s1", Weight: colorToWeight[colors[rng.Intn(len(colors))]]},
+		},
+	}
+	delete(wh.Packages, packages[0])
+	delete(wh.Packages, packages[1])
+
+	truckPos := SortedPositions(wh.Trucks)[0]
+	truck := wh.Trucks[truckPos]
+	order := Order{Name: "o1", Staging: packages[1], Truck: truck.Name}
+	for _, pos := range packages[2:4] {
+		pack := wh.Packages[pos]
+		pack.Order = order.Name
+		wh.Packages[pos] = pack
+		order.Packages = append(order.Packages, pack.Name)
+		order.Weight += pack.Weight
+	}
+	if truck.MaxWeight < order.Weight {
+		truck.MaxWeight = order.Weight
+		wh.Trucks[truckPos] = truck
+	}
+	wh.Orders = append(wh.Orders, order)
+	return wh
+}
+
+// featureScenarios scenarios using what the generated warehouses don't: lanes, exits, costs, walls, lifts between
+// floors, the eight-connected and hexagonal neighbourhoods, racks, orders and the put-away mission
+var featureScenarios = map[string]string{
+	"lanes and exits": `6 5 60
+p1 5 0 green
+p2 5 4 yellow
+f1 0 0
+f2 0 4
+t1 0 2 4000 5
+lane aisle 1 2 5 2
+exits 0 1 down,right
+exits 3 3 up,left
+`,
+	"floors, lifts and costs": `4 3 80
+level 1
+p1 3 2 green
+lane upstairs 0 1 2 1
+costs
+1 1 1 1
+1 5 5 1
+1 1 1 1
+level 0
+p2 2 0 blue
+f1 0 0
+t1 0 2 4000 5
+wall 1 1
+lift l1 3 0 0 1 2 1
+costs
+1 3 1 1
+1 1 1 1
+1 1 2 1
+`,
+	"eight-connected": `5 5 60
+neighbourhood 8
+p1 4 0 green
+p2 2 4 blue
+f1 0 0
+t1 0 4 4000 5
+exits 1 1 down-right,down
+wall 2 2
+`,
+	"hexagonal": `6 6 80
+neighbourhood hex
+p1 5 5 green
+p2 2 2 green
+f1 0 0
+t1 0 5 4000 5
+lane l 3 0 3 4
+exits 1 3 up-right,down-left
+`,
+	"put-away": `6 4 100
+f1 0 0
+f2 0 3
+t1 0 1 4000 5
+mission putaway lowest
+cargo t1 a:blue b:green c:yellow d:green
+rack r1 4 0 2 1 old:blue
+rack r2 4 3 3 1
+rack r3 5 1 3 1
+`,
+	"racks and orders": `6 5 200
+a 1 1 blue
+b 4 1 green
+c 2 3 yellow
+d 4 3 green
+f1 0 0
+f2 5 4
+t1 0 4 900 3
+t2 5 0 1000 3
+rack r1 2 0 2 1 e:green
+order o1 3 2 t1 a c d
+`,
+}
+
+// TestFeatureScenariosRoundTrip writes the feature scenarios and every cycle of their runs in the line format and
+// in JSON, and checks that they're read back unchanged, with the cargo unloaded, the packages carried and the
+// orders staged, consolidated and loaded on the way
+func TestFeatureScenariosRoundTrip(t *testing.T) {
+	var unloaded, carried, staged, consolidated, loaded bool
+
+	for name, scenario := range featureScenarios {
+		wh, cycles, err := parseInputFile(strings.NewReader(scenario))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		simulation := NewSimulation(wh, cycles, Dijkstra)
+		checkRoundTrip(t, name, 0, simulation.Warehouse, cycles)
+		for !simulation.IsOver() {
+			state := simulation.Step()
+			checkRoundTrip(t, name, simulation.Cycle, state.Warehouse, cycles)
+
+			for _, forklift := range state.Warehouse.ForkLifts {
+				_, carrying := forklift.Carrying()
+				carried = carried || carrying
+			}
+			for _, truck := range state.Warehouse.Trucks {
+				unloaded = unloaded || (state.Warehouse.Mission == PutAway && len(truck.Cargo) != 0 &&
+					len(truck.Cargo) < 4)
+			}
+			for _, order := range state.Warehouse.Orders {
+				staged = staged || len(order.Staged) != 0
+				consolidated = consolidated || order.Consolidated
+				loaded = loaded || order.Loaded != 0
+			}
+		}
+	}
+
+	if !unloaded || !carried || !staged || !consolidated || !loaded {
+		t.Errorf("the runs should cover partially unloaded cargo %t, carried packages %t, staged %t, "+
+			"consolidated %t and loaded orders %t", unloaded, carried, staged, consolidated, loaded)
+	}
+}
+
+func checkRoundTrip(t *testing.T, run string, cycle uint, wh Warehouse, cycles uint) {
+	t.Helper()
+
+	var line bytes.Buffer
+	if err := writeInputFile(&line, wh, cycles); err != nil {
+		t.Fatalf("%s, cycle %d: writing the line format: %v", run, cycle, err)
+	}
+	written := line.String()
+	parsed, parsedCycles, err := parseInputFile(&line)
+	if err != nil {
+		t.Fatalf("%s, cycle %d: reading the line format: %v\n%s", run, cycle, err, written)
+	}
+	if parsedCycles != cycles || !reflect.DeepEqual(normalized(parsed), normalized(wh)) {
+		t.Fatalf("%s, cycle %d: the line format read back\n%+v\ndiffers from\n%+v\n%s", run, cycle,
+			normalized(parsed), normalized(wh), written)
+	}
+
+	var json bytes.Buffer
+	if err = writeJSONFile(&json, wh, cycles); err != nil {
+		t.Fatalf("%s, cycle %d: writing JSON: %v", run, cycle, err)
+	}
+	parsed, parsedCycles, err = parseJSONFile(json.Bytes())
+	if err != nil {
+		t.Fatalf("%s, cycle %d: reading JSON: %v\n%s", run, cycle, err, json.String())
+	}
+	if parsedCycles != cycles || !reflect.DeepEqual(normalized(parsed), normalized(wh)) {
+		t.Fatalf("%s, cycle %d: JSON read back\n%+v\ndiffers from\n%+v\n%s", run, cycle, normalized(parsed),
+			normalized(wh), json.String())
+	}
+}
+
+// normalized a copy of a Warehouse whose empty slices and maps are nil, for the ones allocated by the parsers and
+// the ones left nil by the simulation to compare equal
+func normalized(wh Warehouse) Warehouse {
+	wh = wh.Clone()
+	for pos, truck := range wh.Trucks {
+		truck.Cargo = emptyToNil(truck.Cargo)
+		wh.Trucks[pos] = truck
+	}
+	for pos, rack := range wh.Racks {
+		rack.Stack = emptyToNil(rack.Stack)
+		wh.Racks[pos] = rack
+	}
+	for index := range wh.Orders {
+		wh.Orders[index].Packages = emptyToNil(wh.Orders[index].Packages)
+		wh.Orders[index].Staged = emptyToNil(wh.Orders[index].Staged)
+	}
+	wh.Orders = emptyToNil(wh.Orders)
+	wh.Lifts = emptyToNil(wh.Lifts)
+	if len(wh.Exits) == 0 {
+		wh.Exits = nil
+	}
+	if len(wh.Costs) == 0 {
+		wh.Costs = nil
+	}
+	if len(wh.Walls) == 0 {
+		wh.Walls = nil
+	}
+	return wh
+}
+
+func emptyToNil[T any](slice []T) []T {
+	if len(slice) == 0 {
+		return nil
+	}
+	return slice
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	. "github.com/Harmos274/gotrans/warehouse"
+)
+
+// writeJSONFile writes a Warehouse as a JSON scenario, parseJSONFile reading it back as the same Warehouse,
+// including the Package carried, the Truck loads and the progress of the Order of a running Warehouse
+func writeJSONFile(file io.Writer, warehouse Warehouse, cycles uint) error {
+	scenario, err := newJSONScenario(warehouse, cycles)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(scenario)
+}
+
+// newJSONScenario describes a Warehouse as a JSON scenario
+func newJSONScenario(warehouse Warehouse, cycles uint) (jsonScenario, error) {
+	if err := checkColors(warehouse); err != nil {
+		return jsonScenario{}, err
+	}
+	scenario := jsonScenario{
+		Length: warehouse.Length,
+		Height: warehouse.Height,
+		Cycles: cycles,
+	}
+	if warehouse.FloorCount() > 1 {
+		scenario.Floors = warehouse.FloorCount()
+	}
+	if warehouse.Neighbourhood != FourConnected {
+		scenario.Neighbourhood = nameOf(nameToNeighbourhood, warehouse.Neighbourhood)
+	}
+	if warehouse.Mission != Outbound {
+		scenario.Mission = nameOf(nameToMission, warehouse.Mission)
+	}
+	if warehouse.Slotting != NearestSlot {
+		scenario.Slotting = nameOf(nameToSlotting, warehouse.Slotting)
+	}
+
+	scenario.describeEntities(warehouse)
+	scenario.describeLayout(warehouse)
+	return scenario, nil
+}
+
+func (scenario *jsonScenario) describeEntities(warehouse Warehouse) {
+	for _, pos := range SortedPositions(warehouse.Packages) {
+		pack := warehouse.Packages[pos]
+		scenario.Packages = append(scenario.Packages, jsonPackage{
+			jsonItem:     newJSONItem(pack),
+			jsonPosition: newJSONPosition(pos),
+		})
+	}
+	for _, pos := range SortedPositions(warehouse.ForkLifts) {
+		forklift := warehouse.ForkLifts[pos]
+		jsonForklift := jsonForkLift{Name: forklift.Name, jsonPosition: newJSONPosition(pos)}
+		if pack, carrying := forklift.Carrying(); carrying {
+			item := newJSONItem(pack)
+			jsonForklift.Carrying = &item
+		}
+		scenario.ForkLifts = append(scenario.ForkLifts, jsonForklift)
+	}
+	for _, pos := range SortedPositions(warehouse.Trucks) {
+		truck := warehouse.Trucks[pos]
+		jsonTruck := jsonTruck{
+			Name:            truck.Name,
+			jsonPosition:    newJSONPosition(pos),
+			MaxWeight:       int(truck.MaxWeight),
+			Cooldown:        truck.ElapseDischargingTime,
+			Cargo:           newJSONItems(truck.Cargo),
+			TimeUntilReturn: truck.TimeUntilReturn,
+		}
+		var cargoWeight Weight
+		for _, pack := range truck.Cargo {
+			cargoWeight += pack.Weight
+		}
+		if truck.CurrentWeight != cargoWeight {
+			current := int(truck.CurrentWeight)
+			jsonTruck.CurrentWeight = &current
+		}
+		scenario.Trucks = append(scenario.Trucks, jsonTruck)
+	}
+	for _, pos := range SortedPositions(warehouse.Racks) {
+		rack := warehouse.Racks[pos]
+		scenario.Racks = append(scenario.Racks, jsonRack{
+			Name:          rack.Name,
+			jsonPosition:  newJSONPosition(pos),
+			Slots:         rack.Slots,
+			RetrievalTime: rack.RetrievalTime,
+			Packages:      newJSONItems(rack.Stack),
+		})
+	}
+	for _, order := range warehouse.Orders {
+		scenario.Orders = append(scenario.Orders, jsonOrder{
+			Name:         order.Name,
+			Staging:      newJSONPosition(order.Staging),
+			Truck:        order.Truck,
+			Packages:     order.Packages,
+			Loaded:       int(order.Loaded),
+			Consolidated: order.Consolidated,
+			Staged:       newJSONItems(order.Staged),
+		})
+	}
+}
+
+func (scenario *jsonScenario) describeLayout(warehouse Warehouse) {
+	for _, pos := range SortedPositions(warehouse.Walls) {
+		scenario.Walls = append(scenario.Walls, newJSONPosition(pos))
+	}
+	for _, pos := range SortedPositions(warehouse.Exits) {
+		exits := jsonExits{jsonPosition: newJSONPosition(pos), Directions: []string{}}
+		if warehouse.Exits[pos] != 0 {
+			exits.Directions = exitNames(warehouse.Exits[pos])
+		}
+		scenario.Exits = append(scenario.Exits, exits)
+	}
+	for floor := 0; floor < warehouse.FloorCount(); floor++ {
+		costly := false
+		for pos := range warehouse.Costs {
+			costly = costly || pos.Floor == floor
+		}
+		if !costly {
+			continue
+		}
+
+		costs := jsonCosts{Floor: floor, Grid: make([][]int, warehouse.Height)}
+		for y := range costs.Grid {
+			costs.Grid[y] = make([]int, warehouse.Length)
+			for x := range costs.Grid[y] {
+				costs.Grid[y][x] = warehouse.CostAt(Position{X: x, Y: y, Floor: floor})
+			}
+		}
+		scenario.Costs = append(scenario.Costs, costs)
+	}
+	for _, lift := range warehouse.Lifts {
+		scenario.Lifts = append(scenario.Lifts, jsonLift{
+			Name:         lift.Name,
+			X:            lift.X,
+			Y:            lift.Y,
+			LowestFloor:  lift.LowestFloor,
+			HighestFloor: lift.HighestFloor,
+			TransferTime: lift.TransferTime,
+			Capacity:     lift.Capacity,
+		})
+	}
+}
+
+func newJSONPosition(pos Position) jsonPosition {
+	return jsonPosition{X: pos.X, Y: pos.Y, Floor: pos.Floor}
+}
+
+func newJSONItem(pack Package) jsonItem {
+	return jsonItem{Name: pack.Name, Color: colorOf(pack.Weight)}
+}
+
+func newJSONItems(packages []Package) []jsonItem {
+	items := make([]jsonItem, 0, len(packages))
+	for _, pack := range packages {
+		items = append(items, newJSONItem(pack))
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}